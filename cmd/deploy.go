@@ -2,197 +2,691 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"deeployer/internal/config"
+	"deeployer/internal/events"
 	"deeployer/internal/executor"
+	"deeployer/internal/git"
+	"deeployer/internal/history"
+	"deeployer/internal/manifest"
+	"deeployer/internal/output"
+	"deeployer/internal/plan"
 	"deeployer/internal/rsync"
 	"deeployer/internal/ssh"
+	"deeployer/internal/tui"
+	"deeployer/pkg/api"
 
 	"github.com/charmbracelet/huh"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 var (
-	dryRun  bool
-	verbose bool
+	dryRun       bool
+	verbose      bool
+	cacheSecrets bool
+	tuiMode      bool
+	noBuild      bool
+	skipPhases   []string
+	skipHooks    []string
+	gitRef       string
 )
 
 var deployCmd = &cobra.Command{
-	Use:   "deploy [project] [remote]",
-	Short: "Deploy a project to a specific remote",
+	Use:   "deploy [project] [remote...]",
+	Short: "Deploy a project to one or more remotes",
 	Long: `Deploy a project by executing its build commands, syncing the output directory 
 to the specified remote server via rsync, and running post-deployment commands.
 
-The remote must be in the project's allowed remotes list.`,
-	Args: cobra.RangeArgs(0, 2),
+The remotes must be in the project's allowed remotes list and are deployed one
+after another, stopping at the first failure. Without a remote, a wizard asks
+for the project, remotes and options and shows a summary before deploying.`,
+	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.Load()
 		if err != nil {
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
-		var projectName string
-		if len(args) <= 0 {
-			options := make([]huh.Option[string], 0, len(cfg.Projects))
-			for name := range cfg.Projects {
-				options = append(options, huh.NewOption(name, name))
-			}
-
-			form := huh.NewForm(
-				huh.NewGroup(
-					huh.NewSelect[string]().
-						Title("Project").
-						Options(options...).
-						Value(&projectName),
-				),
-			)
-
-			err := form.Run()
-			if err != nil {
-				return fmt.Errorf("failed to select project: %w", err)
+		for _, phase := range skipPhases {
+			if !slices.Contains(deployPhases, phase) {
+				return fmt.Errorf("unknown phase %q: expected one of %s", phase, strings.Join(deployPhases, ", "))
+			}
+		}
+
+		for _, hook := range skipHooks {
+			if hook != "all" && !slices.Contains(config.HookNames, hook) {
+				return fmt.Errorf("unknown hook %q: expected all or one of %s", hook, strings.Join(config.HookNames, ", "))
 			}
+		}
 
-			if projectName == "" {
-				return fmt.Errorf("no project selected")
+		var projectName string
+		var project config.Project
+		var remoteNames []string
+		confirmed := assumeYes
+		if len(args) >= 2 {
+			projectName, project, err = selectProject(cfg, args)
+			if err != nil {
+				return err
 			}
+			remoteNames = args[1:]
 		} else {
-			projectName = args[0]
+			var protected bool
+			projectName, project, remoteNames, protected, err = runWizard(cfg, args)
+			if err != nil {
+				return err
+			}
+			if len(remoteNames) == 0 {
+				// Cancelled
+				return nil
+			}
+			confirmed = confirmed || protected
 		}
 
-		project, exists := cfg.Projects[projectName]
-		if !exists {
-			return fmt.Errorf("project '%s' not found in configuration", projectName)
+		if len(remoteNames) > 1 && outputFormat != outputText {
+			return fmt.Errorf("--output %s supports a single remote per deploy", outputFormat)
 		}
 
-		var remoteName string
-		if len(args) <= 1 {
-			options := make([]huh.Option[string], 0, len(project.Remotes))
-			for _, remote := range project.Remotes {
-				options = append(options, huh.NewOption(remote, remote))
+		// Every check and step sees the remotes with the project's
+		// overrides applied
+		remotes := make(map[string]config.Remote, len(remoteNames))
+		for _, remoteName := range remoteNames {
+			remote, err := resolveRemote(cfg, projectName, project, remoteName)
+			if err != nil {
+				return err
 			}
+			remotes[remoteName] = remote
+		}
 
-			form := huh.NewForm(
-				huh.NewGroup(
-					huh.NewSelect[string]().
-						Title("Project").
-						Options(options...).
-						Value(&remoteName),
-				),
-			)
+		if !dryRun {
+			if err := checkGates(remoteNames, remotes, confirmed); err != nil {
+				cmd.SilenceUsage = true
+				return err
+			}
+		}
 
-			err := form.Run()
+		// Checked once, as building for one remote may leave changes in the
+		// working tree before the next
+		commit, err := checkGit(project, gitRef, !dryRun)
+		if err != nil {
+			cmd.SilenceUsage = true
+			return err
+		}
+
+		// A dry run only resolves the ref, and its plan says it builds from
+		// a checkout of it
+		if gitRef != "" && !dryRun {
+			var cleanup func()
+			project, cleanup, err = checkoutRef(project, *commit)
 			if err != nil {
-				return fmt.Errorf("failed to select remote: %w", err)
+				return err
 			}
+			defer cleanup()
+		}
 
-			if remoteName == "" {
-				return fmt.Errorf("no remote selected")
+		// One stream covers every remote
+		bus, closeEvents, err := openEvents()
+		if err != nil {
+			return err
+		}
+		defer closeEvents()
+
+		interrupt := catchInterrupts()
+		defer interrupt.Stop()
+
+		for _, remoteName := range remoteNames {
+			select {
+			case <-interrupt.Done():
+				return plan.ErrInterrupted
+			default:
+			}
+
+			if err := deployProject(projectName, project, remoteName, remotes[remoteName], commit, bus, interrupt); err != nil {
+				return err
 			}
-		} else {
-			remoteName = args[1]
 		}
 
-		return deployProject(cfg, projectName, project, remoteName)
+		return nil
 	},
 }
 
-func deployProject(cfg *config.Config, projectName string, project config.Project, remoteName string) error {
-	// Validate that the remote is allowed for this project
-	remoteAllowed := slices.Contains(project.Remotes, remoteName)
+// deployPhases are the phases of a deploy, in order.
+var deployPhases = []string{"build", "sync", "remote_post", "health_check", "local_post"}
 
-	if !remoteAllowed {
-		return fmt.Errorf("remote '%s' is not allowed for project '%s'. Available remotes: %s",
-			remoteName, projectName, strings.Join(project.Remotes, ", "))
+// failureTailLines is how much of the failing step's output is repeated in
+// the failure report.
+const failureTailLines = 20
+
+func deployProject(projectName string, project config.Project, remoteName string, remote config.Remote, commit *git.Commit, bus *events.Bus, interrupt *interrupter) (err error) {
+	p, err := buildPlan(projectName, project, remoteName, remote, commit)
+	if err != nil {
+		return err
 	}
 
-	// Check if remote exists in configuration
-	remote, exists := cfg.Remotes[remoteName]
-	if !exists {
-		return fmt.Errorf("remote '%s' not found in configuration", remoteName)
+	result := api.DeployResult{
+		Project:   projectName,
+		Remote:    remoteName,
+		DryRun:    dryRun,
+		Ref:       gitRef,
+		StartedAt: time.Now(),
+		Phases:    []api.PhaseResult{},
+	}
+	if commit != nil {
+		result.Commit = commit.SHA
+	}
+
+	if dryRun {
+		if outputFormat == outputText {
+			return p.WriteText(humanOutput)
+		}
+		result.Plan = apiPlan(p)
+		finishResult(&result, nil)
+		return writeResult(result)
 	}
 
-	exec := executor.New(dryRun, verbose)
-	rsyncClient := rsync.New(dryRun, verbose)
-	sshClient := ssh.New(dryRun, verbose)
+	// The dashboard needs the terminal to itself, so plain output is used
+	// when stdout is not one or carries machine-readable data
+	useTUI := tuiMode && outputFormat == outputText && !eventsOnStdout() && term.IsTerminal(int(os.Stdout.Fd()))
+	clientVerbose := verbose && !useTUI
+
+	if bus == nil && useTUI {
+		bus = events.NewBus()
+	}
+
+	human := humanOutput
+	if useTUI {
+		human = io.Discard
+	}
+
+	sink := output.NewSink(human, output.DefaultLimit)
+	sink.Events = bus
+
+	exec := executor.New(false, clientVerbose)
+	exec.Output = sink
+	exec.Events = bus
+	rsyncClient := rsync.New(false, clientVerbose)
+	rsyncClient.Output = sink
+	rsyncClient.Events = bus
+	rsyncClient.HideProgress = useTUI
+	sshClient := ssh.New(false, clientVerbose)
+	sshClient.Output = sink
+	sshClient.Events = bus
+	sshClient.CacheSecrets = cacheSecrets
+	defer sshClient.Close()
+
+	record := history.Record{
+		Project:   projectName,
+		Remote:    remoteName,
+		Commit:    result.Commit,
+		Ref:       gitRef,
+		StartedAt: result.StartedAt,
+	}
+	defer func() {
+		if err != nil {
+			reportFailure(sink)
+		}
+		finishRecord(&record, sink, err)
+		if histErr := history.Append(record); histErr != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save deploy record: %v\n", histErr)
+		}
+
+		if outputFormat != outputText {
+			finishResult(&result, err)
+			if writeErr := writeResult(result); writeErr != nil && err == nil {
+				err = writeErr
+			}
+		}
+	}()
 
 	if verbose {
-		fmt.Printf("Deploying project: %s (path: %s) to remote: %s\n", projectName, project.Path, remoteName)
+		fmt.Fprintf(humanOutput, "Deploying project: %s (path: %s) to remote: %s\n", projectName, project.Path, remoteName)
 	}
 
 	if err := rsyncClient.CheckRsyncAvailable(); err != nil {
 		return fmt.Errorf("rsync check failed: %w", err)
 	}
 
-	if verbose {
-		fmt.Println("Executing build commands...")
+	containers, err := plan.ResolveContainers(p)
+	if err != nil {
+		return err
 	}
-	if err := exec.ExecuteCommands(project.BuildCommands, project.Path); err != nil {
-		return fmt.Errorf("build commands failed: %w", err)
+
+	var synced *rsync.Stats
+	runner := &plan.Runner{
+		Executor: exec,
+		Rsync:    rsyncClient,
+		SSH:      sshClient,
+		Verbose:  clientVerbose,
+		Events:   bus,
+		Targets:  map[string]ssh.Target{remoteName: sshTarget(remote)},
+
+		Containers: containers,
+		Interrupt:  interrupt.Done(),
+		OnSync: func(stats rsync.Stats) {
+			// A project with several sync mappings records their total
+			if synced == nil {
+				synced = &rsync.Stats{}
+			}
+			synced.Add(stats)
+			transfer := history.Transfer(*synced)
+			record.Transfer = &transfer
+			apiTransfer := api.Transfer(*synced)
+			result.Transfer = &apiTransfer
+			if !useTUI {
+				printTransferSummary(stats)
+			}
+		},
 	}
 
-	// Validate output directory doesn't contain directory traversal
-	if strings.Contains(project.OutputDir, "..") {
-		return fmt.Errorf("output directory contains directory traversal: %s", project.OutputDir)
+	run := func() error {
+		phases, err := runner.Run(p)
+		for _, phase := range phases {
+			entry := api.PhaseResult{
+				Name:       phase.Name,
+				Status:     string(phase.Status),
+				DurationMS: phase.Duration.Milliseconds(),
+			}
+			if phase.Err != nil {
+				entry.Error = phase.Err.Error()
+			}
+			result.Phases = append(result.Phases, entry)
+		}
+		return err
 	}
 
-	outputPath := filepath.Join(project.Path, project.OutputDir)
-	// Clean the path to resolve any remaining . or .. elements
-	outputPath = filepath.Clean(outputPath)
+	if useTUI {
+		dashboard := tui.New(fmt.Sprintf("Deploying %s to %s", projectName, remoteName), p.PhaseNames())
+		sshClient.Interact = dashboard.Interact
+		dashboard.OnInterrupt = interrupt.Interrupt
+		err = dashboard.Run(bus, run)
+		if synced != nil {
+			printTransferSummary(*synced)
+		}
+	} else {
+		err = run()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(humanOutput, "Successfully deployed %s to %s\n", projectName, remoteName)
+	return nil
+}
+
+// postSteps returns a remote step for each post command, on a terminal
+// when the command asks for one.
+func postSteps(commands []config.RemoteCommand, target plan.Target) []plan.Step {
+	steps := plan.RemoteSteps(config.Commands(commands), target)
+	for i, c := range commands {
+		steps[i].PTY = c.PTY
+	}
+	return steps
+}
 
-	// Ensure the cleaned path is still within the project directory
-	projectAbsPath, err := filepath.Abs(project.Path)
+// buildPlan resolves every step of deploying the project to the remote,
+// as resolveRemote returns it, without running or checking anything on
+// disk beyond the configuration. commit, when known, is exported to local
+// commands.
+func buildPlan(projectName string, project config.Project, remoteName string, remote config.Remote, commit *git.Commit) (*plan.Plan, error) {
+	projectPath, err := filepath.Abs(project.Path)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute project path: %w", err)
+		return nil, fmt.Errorf("failed to get absolute project path: %w", err)
 	}
 
-	outputAbsPath, err := filepath.Abs(outputPath)
+	targets, err := resolveSyncs(project, remote)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute output path: %w", err)
+		return nil, err
 	}
 
-	if !strings.HasPrefix(outputAbsPath, projectAbsPath) {
-		return fmt.Errorf("output directory is outside project directory: %s", outputAbsPath)
+	target := planTarget(remoteName, remote)
+	env := []string{
+		"DEEPLOYER_PROJECT=" + projectName,
+		"DEEPLOYER_REMOTE=" + remoteName,
+	}
+	if commit != nil {
+		env = append(env, "DEEPLOYER_GIT_SHA="+commit.SHA)
 	}
 
-	if err := exec.CheckOutputDir(outputPath); err != nil {
-		return fmt.Errorf("output directory check failed: %w", err)
+	releaseManifest := &plan.Manifest{
+		Dest:    path.Join(remote.Path, manifest.Path),
+		Project: projectName,
+		Ref:     gitRef,
+	}
+	if commit != nil {
+		releaseManifest.Commit = commit.SHA
 	}
 
-	if verbose {
-		fmt.Printf("Syncing to remote: %s\n", remoteName)
+	syncSteps := make([]plan.Step, 0, len(targets)+2)
+	for _, t := range targets {
+		syncSteps = append(syncSteps, plan.Step{
+			Kind:   plan.StepSync,
+			Target: &target,
+			Sync: &plan.Sync{
+				Source:  t.Source,
+				Dest:    t.Dest,
+				Options: t.Options,
+				Filters: t.Filters,
+			},
+		})
+		syncSteps = append(syncSteps, plan.RemoteSteps(t.Fixup, target)...)
+
+		// The manifest only covers what is synced inside the remote path
+		if t.Inside {
+			releaseManifest.Sources = append(releaseManifest.Sources, plan.ManifestSource{
+				Source: t.Source,
+				Prefix: t.Prefix,
+				Ignore: t.Rules.Patterns(),
+			})
+		}
+	}
+	syncSteps = append(syncSteps, plan.Step{Kind: plan.StepManifest, Target: &target, Manifest: releaseManifest})
+
+	// Record what a ref deploy put on the remote, after the sync so that
+	// --delete cannot remove it
+	if gitRef != "" && commit != nil {
+		revision := fmt.Sprintf("printf '%%s\\n' %s %s > %s",
+			ssh.Quote(commit.SHA), ssh.Quote(gitRef), ssh.Quote(path.Join(remote.Path, revisionFile)))
+		syncSteps = append(syncSteps, plan.RemoteSteps([]string{revision}, target)...)
+	}
+
+	// A project's hooks run locally, then the remote's hooks run there
+	hook := func(name string) []plan.Step {
+		steps := plan.LocalSteps(project.Hooks.Commands(name), projectPath, env)
+		return append(steps, plan.RemoteSteps(remote.Hooks.Commands(name), target)...)
 	}
-	if err := rsyncClient.Sync(outputPath, remote.User, remote.Host, remote.Path, remote.RsyncOptions); err != nil {
-		return fmt.Errorf("rsync to %s failed: %w", remoteName, err)
+
+	p := &plan.Plan{Project: projectName, Remote: remoteName}
+	if gitRef != "" && commit != nil {
+		p.Ref, p.Commit = gitRef, commit.Short
+	}
+	p.AddPhase("pre_build", hook("pre_build")...)
+	p.AddPhase("build", buildSteps(project, projectPath, env)...)
+	p.AddPhase("post_build", hook("post_build")...)
+	enableMaintenance, disableMaintenance := maintenanceSteps(remote, target)
+
+	p.AddPhase("pre_sync", hook("pre_sync")...)
+	p.AddPhase("maintenance_on", enableMaintenance...)
+	p.AddPhase("sync", syncSteps...)
+	p.AddPhase("post_sync", hook("post_sync")...)
+	p.AddPhase("remote_post", postSteps(remote.PostCommands, target)...)
+	p.AddCleanupPhase("maintenance_off", "maintenance_on", disableMaintenance...)
+	// Checked once the site is out of maintenance mode, as visitors see it
+	p.AddPhase("health_check", plan.HealthCheckSteps(remote.HealthChecks, target)...)
+	// The project's post commands clean up after the build, so they run
+	// even when the deploy fails
+	p.AddPhaseWhen("local_post", plan.WhenAlways, plan.LocalSteps(project.PostCommands, projectPath, env)...)
+	p.AddPhase("on_success", hook("on_success")...)
+	p.AddPhaseWhen("on_failure", plan.WhenFailed, hook("on_failure")...)
+	p.AddPhaseWhen("always", plan.WhenAlways, hook("always")...)
+
+	p.RemovePhases(skipPhases...)
+	if slices.Contains(skipPhases, "sync") {
+		// Maintenance mode only covers the sync
+		p.RemovePhases("maintenance_on", "maintenance_off")
+	}
+	if noBuild {
+		// The build hooks belong to the build
+		p.RemovePhases("pre_build", "build", "post_build")
+	}
+	if slices.Contains(skipHooks, "all") {
+		p.RemovePhases(config.HookNames...)
+	} else {
+		p.RemovePhases(skipHooks...)
+	}
+
+	return p, nil
+}
+
+// buildSteps returns the project's build commands, run in its build image
+// when it has one.
+func buildSteps(project config.Project, projectPath string, env []string) []plan.Step {
+	if project.BuildImage == "" {
+		return plan.LocalSteps(project.BuildCommands, projectPath, env)
 	}
+	container := plan.Container{Image: project.BuildImage, Runtime: project.BuildRuntime}
+	return plan.ContainerSteps(project.BuildCommands, projectPath, env, container)
+}
 
-	if len(remote.PostCommands) > 0 {
-		if verbose {
-			fmt.Printf("Executing post commands on remote: %s\n", remoteName)
+// apiPlan converts a plan to its machine-readable form.
+func apiPlan(p *plan.Plan) *api.Plan {
+	result := &api.Plan{Phases: make([]api.PlanPhase, 0, len(p.Phases))}
+	for _, phase := range p.Phases {
+		entry := api.PlanPhase{
+			Name:  phase.Name,
+			When:  string(phase.When),
+			After: phase.After,
+			Steps: make([]api.PlanStep, 0, len(phase.Steps)),
 		}
-		if err := sshClient.ExecuteCommands(remote.Host, remote.User, remote.PostCommands); err != nil {
-			return fmt.Errorf("remote post commands failed on %s: %w", remoteName, err)
+		for _, step := range phase.Steps {
+			planStep := api.PlanStep{
+				Kind:    string(step.Kind),
+				Command: step.Command,
+				Dir:     step.Dir,
+				Env:     step.Env,
+			}
+			if step.Container != nil {
+				planStep.Image = step.Container.Image
+			}
+			if step.Kind == plan.StepRemote || step.Kind == plan.StepHealthCheck {
+				planStep.Command = step.RemoteCommand()
+			}
+			if step.Target != nil {
+				planStep.Remote = step.Target.Name
+				planStep.Host = step.Target.Host
+				planStep.User = step.Target.User
+			}
+			planStep.PTY = step.PTY
+			if step.Manifest != nil {
+				planStep.Dest = step.Manifest.Dest
+			}
+			if step.Sync != nil {
+				planStep.Source = step.Sync.Source
+				planStep.Dest = step.Sync.Dest
+				planStep.Options = step.Sync.Options
+				planStep.Filters = step.Sync.Filters
+			}
+			entry.Steps = append(entry.Steps, planStep)
 		}
+		result.Phases = append(result.Phases, entry)
 	}
+	return result
+}
 
-	if len(project.PostCommands) > 0 {
-		if verbose {
-			fmt.Println("Executing local post commands...")
+func finishResult(result *api.DeployResult, err error) {
+	result.FinishedAt = time.Now()
+	result.DurationMS = result.FinishedAt.Sub(result.StartedAt).Milliseconds()
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+}
+
+// selectProject returns the project named by the first argument, asking
+// for one when no arguments are given.
+func selectProject(cfg *config.Config, args []string) (string, config.Project, error) {
+	var projectName string
+	if len(args) <= 0 {
+		options := make([]huh.Option[string], 0, len(cfg.Projects))
+		for name := range cfg.Projects {
+			options = append(options, huh.NewOption(name, name))
 		}
-		if err := exec.ExecuteCommands(project.PostCommands, project.Path); err != nil {
-			return fmt.Errorf("local post commands failed: %w", err)
+
+		form := huh.NewForm(
+			huh.NewGroup(
+				huh.NewSelect[string]().
+					Title("Project").
+					Options(options...).
+					Value(&projectName),
+			),
+		)
+
+		err := form.Run()
+		if err != nil {
+			return "", config.Project{}, fmt.Errorf("failed to select project: %w", err)
 		}
+
+		if projectName == "" {
+			return "", config.Project{}, fmt.Errorf("no project selected")
+		}
+	} else {
+		projectName = args[0]
 	}
 
-	fmt.Printf("Successfully deployed %s to %s\n", projectName, remoteName)
-	return nil
+	project, exists := cfg.Projects[projectName]
+	if !exists {
+		return "", config.Project{}, fmt.Errorf("project '%s' not found in configuration", projectName)
+	}
+
+	return projectName, project, nil
+}
+
+// selectRemote returns the remote named by the second argument, asking for
+// one of the project's remotes when it is not given.
+func selectRemote(project config.Project, args []string) (string, error) {
+	var remoteName string
+	if len(args) <= 1 {
+		options := make([]huh.Option[string], 0, len(project.Remotes))
+		for _, remote := range project.Remotes {
+			options = append(options, huh.NewOption(remote, remote))
+		}
+
+		form := huh.NewForm(
+			huh.NewGroup(
+				huh.NewSelect[string]().
+					Title("Remote").
+					Options(options...).
+					Value(&remoteName),
+			),
+		)
+
+		err := form.Run()
+		if err != nil {
+			return "", fmt.Errorf("failed to select remote: %w", err)
+		}
+
+		if remoteName == "" {
+			return "", fmt.Errorf("no remote selected")
+		}
+	} else {
+		remoteName = args[1]
+	}
+
+	return remoteName, nil
+}
+
+// resolveRemote checks that the project may deploy to remoteName and
+// returns its configuration.
+func resolveRemote(cfg *config.Config, projectName string, project config.Project, remoteName string) (config.Remote, error) {
+	// Validate that the remote is allowed for this project
+	remoteAllowed := slices.Contains(project.Remotes, remoteName)
+
+	if !remoteAllowed {
+		return config.Remote{}, fmt.Errorf("remote '%s' is not allowed for project '%s'. Available remotes: %s",
+			remoteName, projectName, strings.Join(project.Remotes, ", "))
+	}
+
+	// Check if remote exists in configuration, applying the project's
+	// overrides
+	remote, exists := cfg.Remote(project, remoteName)
+	if !exists {
+		return config.Remote{}, fmt.Errorf("remote '%s' not found in configuration", remoteName)
+	}
+
+	return remote, nil
+}
+
+func printTransferSummary(stats rsync.Stats) {
+	fmt.Fprintln(humanOutput, "Sync summary:")
+	fmt.Fprintf(humanOutput, "  Created:     %d\n", stats.Created)
+	fmt.Fprintf(humanOutput, "  Updated:     %d\n", stats.Updated)
+	fmt.Fprintf(humanOutput, "  Deleted:     %d\n", stats.Deleted)
+	fmt.Fprintf(humanOutput, "  Transferred: %s of %s (sent %s, received %s)\n",
+		rsync.FormatBytes(stats.TransferredSize), rsync.FormatBytes(stats.TotalSize),
+		rsync.FormatBytes(stats.BytesSent), rsync.FormatBytes(stats.BytesReceived))
+}
+
+// reportFailure repeats the end of the failing step's output, which may
+// have scrolled far out of view by the time the deploy gives up.
+func reportFailure(sink *output.Sink) {
+	step := sink.Failed()
+	if step == nil {
+		return
+	}
+
+	lines := step.Tail(failureTailLines)
+	if len(lines) == 0 {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "\nLast %d line(s) of [%s] %s:\n", len(lines), step.Label, step.Name)
+	for _, line := range lines {
+		fmt.Fprintf(os.Stderr, "  %s\n", line)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+func finishRecord(record *history.Record, sink *output.Sink, err error) {
+	record.FinishedAt = time.Now()
+	record.Success = err == nil
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	for _, step := range sink.Steps() {
+		entry := history.Step{
+			Label:      step.Label,
+			Name:       step.Name,
+			StartedAt:  step.StartedAt,
+			FinishedAt: step.FinishedAt,
+			Output:     step.Output(),
+			Truncated:  step.Truncated(),
+		}
+		if step.Err != nil {
+			entry.Error = step.Err.Error()
+		}
+		record.Steps = append(record.Steps, entry)
+	}
+}
+
+// planTarget returns the target of a remote's steps, which exports the
+// remote's env to every command run there.
+func planTarget(remoteName string, remote config.Remote) plan.Target {
+	return plan.Target{Name: remoteName, Host: remote.Host, User: remote.User, Env: remote.EnvList()}
+}
+
+func sshTarget(remote config.Remote) ssh.Target {
+	return ssh.Target{
+		Host:                remote.Host,
+		User:                remote.User,
+		HostKeyFingerprints: remote.HostKeyFingerprints,
+		Auth:                remote.Auth,
+		IdentityFile:        remote.IdentityFile,
+		CertificateFile:     remote.CertificateFile,
+		PTY:                 remote.PTY,
+		SudoPasswordEnv:     remote.SudoPasswordEnv,
+	}
 }
 
 func init() {
 	rootCmd.AddCommand(deployCmd)
 
 	deployCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be executed without making changes")
+	deployCmd.Flags().StringVar(&gitRef, "ref", "", "Build and deploy this git tag, branch or commit from a clean checkout")
+	deployCmd.Flags().BoolVar(&noBuild, "no-build", false, "Deploy the existing output directory without building")
+	deployCmd.Flags().StringSliceVar(&skipPhases, "skip", nil, "Phases to skip: "+strings.Join(deployPhases, ", "))
+	deployCmd.Flags().StringSliceVar(&skipHooks, "skip-hooks", nil, "Hooks to skip, or all: "+strings.Join(config.HookNames, ", "))
 	deployCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	deployCmd.Flags().BoolVar(&tuiMode, "tui", false, "Show a full-screen dashboard while deploying")
+	deployCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "Deploy to protected remotes without asking")
+	deployCmd.Flags().BoolVar(&overrideWindow, "override-window", false, "Deploy even outside a remote's deploy window")
+	deployCmd.Flags().StringVar(&eventsFormat, "events", "", "Stream progress events in this format: ndjson")
+	deployCmd.Flags().StringVar(&eventsTo, "events-to", "", "Write events to a file or to unix:<socket> instead of stdout")
+	deployCmd.Flags().BoolVar(&cacheSecrets, "cache-secrets", false, "Remember key passphrases and passwords for the rest of the run")
 }
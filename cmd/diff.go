@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+
+	"deeployer/internal/config"
+	"deeployer/internal/executor"
+	"deeployer/internal/rsync"
+	"deeployer/internal/ssh"
+
+	"github.com/spf13/cobra"
+)
+
+// exitChanges is the exit status of diff when the remote would change.
+const exitChanges = 2
+
+var (
+	diffNoBuild  bool
+	diffChecksum bool
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [project] [remote]",
+	Short: "Show what a deploy would change on a remote",
+	Long: `Build the project and compare its output directory with the remote, listing the
+files a deploy would create, modify or delete. Nothing is changed on the remote.
+
+Exits with status 2 when there are changes, so CI can gate on it.`,
+	Args: cobra.RangeArgs(0, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		projectName, project, err := selectProject(cfg, args)
+		if err != nil {
+			return err
+		}
+
+		remoteName, err := selectRemote(project, args)
+		if err != nil {
+			return err
+		}
+
+		changes, err := diffProject(cfg, projectName, project, remoteName)
+		if err != nil {
+			return err
+		}
+
+		printChanges(projectName, remoteName, changes)
+
+		if len(changes) > 0 {
+			cmd.SilenceUsage = true
+			return &exitError{
+				code: exitChanges,
+				err:  fmt.Errorf("%s differs from %s: %d change(s)", remoteName, projectName, len(changes)),
+			}
+		}
+
+		return nil
+	},
+}
+
+func diffProject(cfg *config.Config, projectName string, project config.Project, remoteName string) ([]rsync.Change, error) {
+	remote, err := resolveRemote(cfg, projectName, project, remoteName)
+	if err != nil {
+		return nil, err
+	}
+
+	exec := executor.New(false, verbose)
+	exec.Output = newSink()
+	rsyncClient := rsync.New(false, verbose)
+	rsyncClient.Output = newSink()
+	sshClient := ssh.New(false, verbose)
+	sshClient.Output = newSink()
+
+	if err := rsyncClient.CheckRsyncAvailable(); err != nil {
+		return nil, fmt.Errorf("rsync check failed: %w", err)
+	}
+
+	if !diffNoBuild {
+		exec, err = exec.WithContainer(project.BuildRuntime, project.BuildImage)
+		if err != nil {
+			return nil, err
+		}
+		if verbose {
+			fmt.Fprintln(humanOutput, "Executing build commands...")
+		}
+		if err := exec.ExecuteCommands(project.BuildCommands, project.Path); err != nil {
+			return nil, fmt.Errorf("build commands failed: %w", err)
+		}
+	}
+
+	return remoteChanges(rsyncClient, sshClient, project, remoteName, remote, diffChecksum)
+}
+
+// remoteChanges compares the project's sync sources, as they are now,
+// with the remote. Paths are relative to the remote path, or absolute for
+// mappings synced outside it.
+func remoteChanges(rsyncClient *rsync.Client, sshClient *ssh.Client, project config.Project, remoteName string, remote config.Remote, checksum bool) ([]rsync.Change, error) {
+	targets, err := resolveSyncs(project, remote)
+	if err != nil {
+		return nil, err
+	}
+	return targetChanges(rsyncClient, sshClient, remoteName, remote, targets, checksum)
+}
+
+// targetChanges compares the resolved sync targets with the remote.
+func targetChanges(rsyncClient *rsync.Client, sshClient *ssh.Client, remoteName string, remote config.Remote, targets []syncTarget, checksum bool) ([]rsync.Change, error) {
+	check := executor.New(false, verbose)
+	check.Output = newSink()
+	for _, t := range targets {
+		if err := check.CheckOutputDir(t.Source); err != nil {
+			return nil, fmt.Errorf("output directory check failed: %w", err)
+		}
+	}
+
+	if err := sshClient.EnsureHostKey(sshTarget(remote)); err != nil {
+		return nil, fmt.Errorf("host key verification failed for %s: %w", remoteName, err)
+	}
+
+	var changes []rsync.Change
+	for _, t := range targets {
+		synced, err := rsyncClient.Changes(t.Source, remote.User, remote.Host, t.Dest, t.Options, t.Filters, checksum)
+		if err != nil {
+			return nil, fmt.Errorf("rsync comparison with %s failed: %w", remoteName, err)
+		}
+		for _, change := range synced {
+			change.Path = t.relPath(change.Path)
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+func printChanges(projectName, remoteName string, changes []rsync.Change) {
+	if len(changes) == 0 {
+		fmt.Fprintf(humanOutput, "%s is up to date with %s\n", remoteName, projectName)
+		return
+	}
+
+	groups := []struct {
+		kind   rsync.ChangeKind
+		title  string
+		marker string
+	}{
+		{rsync.ChangeNew, "New", "+"},
+		{rsync.ChangeModified, "Modified", "~"},
+		{rsync.ChangeDeleted, "Deleted", "-"},
+	}
+
+	counts := make(map[rsync.ChangeKind]int)
+	for _, change := range changes {
+		counts[change.Kind]++
+	}
+
+	fmt.Fprintf(humanOutput, "Changes for %s on %s:\n", projectName, remoteName)
+	for _, group := range groups {
+		if counts[group.kind] == 0 {
+			continue
+		}
+
+		fmt.Fprintf(humanOutput, "\n%s (%d):\n", group.title, counts[group.kind])
+		for _, change := range changes {
+			if change.Kind == group.kind {
+				fmt.Fprintf(humanOutput, "  %s %-50s %10s\n", group.marker, change.Path, rsync.FormatBytes(change.Size))
+			}
+		}
+	}
+
+	fmt.Fprintf(humanOutput, "\n%s\n", summarizeChanges(changes))
+}
+
+// summarizeChanges counts the changes by kind, such as
+// "3 new, 1 modified, 0 deleted (12.0 KiB to transfer)".
+func summarizeChanges(changes []rsync.Change) string {
+	if len(changes) == 0 {
+		return "up to date"
+	}
+
+	counts := make(map[rsync.ChangeKind]int)
+	var transferSize int64
+	for _, change := range changes {
+		counts[change.Kind]++
+		if change.Kind != rsync.ChangeDeleted {
+			transferSize += change.Size
+		}
+	}
+
+	return fmt.Sprintf("%d new, %d modified, %d deleted (%s to transfer)",
+		counts[rsync.ChangeNew], counts[rsync.ChangeModified], counts[rsync.ChangeDeleted], rsync.FormatBytes(transferSize))
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().BoolVar(&diffNoBuild, "no-build", false, "Compare the existing output directory without building")
+	diffCmd.Flags().BoolVar(&diffChecksum, "checksum", false, "Compare file contents instead of size and modification time")
+	diffCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"deeployer/internal/events"
+)
+
+var (
+	eventsFormat string
+	eventsTo     string
+)
+
+const (
+	// eventQueueSize is how many events may wait for a slow --events-to
+	// reader before more are dropped.
+	eventQueueSize = 4096
+	// eventFlushTimeout is how long a finished deploy waits for the
+	// queued events to be written.
+	eventFlushTimeout = 2 * time.Second
+)
+
+// openEvents sets up the event stream requested with --events and
+// --events-to, once per command. Without --events it returns a nil bus,
+// which discards events. The returned function writes the events still
+// queued and closes the destination.
+func openEvents() (*events.Bus, func() error, error) {
+	noClose := func() error { return nil }
+
+	switch eventsFormat {
+	case "":
+		return nil, noClose, nil
+	case "ndjson":
+	default:
+		return nil, nil, fmt.Errorf("unknown event format %q: expected ndjson", eventsFormat)
+	}
+
+	var w io.WriteCloser
+	switch {
+	case eventsOnStdout():
+		if outputFormat != outputText {
+			return nil, nil, fmt.Errorf("events cannot share stdout with --output %s; use --events-to", outputFormat)
+		}
+		// The stream takes over stdout; setupOutput has already moved the
+		// output for people to stderr
+		bus := events.NewBus()
+		bus.Subscribe(events.NDJSON(os.Stdout))
+		return bus, noClose, nil
+
+	case strings.HasPrefix(eventsTo, "unix:"):
+		conn, err := net.Dial("unix", strings.TrimPrefix(eventsTo, "unix:"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to event socket: %w", err)
+		}
+		w = conn
+
+	default:
+		f, err := os.OpenFile(eventsTo, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open event file: %w", err)
+		}
+		w = f
+	}
+
+	// A reader that falls behind loses events rather than holding up
+	// the deploy
+	subscriber, stop := events.NDJSONQueue(w, eventQueueSize)
+	bus := events.NewBus()
+	bus.Subscribe(subscriber)
+
+	closeFn := func() error {
+		if dropped := stop(eventFlushTimeout); dropped > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: dropped %d events that %s did not read in time\n", dropped, eventsTo)
+		}
+		return w.Close()
+	}
+	return bus, closeFn, nil
+}
+
+func eventsOnStdout() bool {
+	return eventsFormat != "" && (eventsTo == "" || eventsTo == "-")
+}
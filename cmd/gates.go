@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"deeployer/internal/config"
+
+	"github.com/charmbracelet/huh"
+	"golang.org/x/term"
+)
+
+var (
+	assumeYes      bool
+	overrideWindow bool
+)
+
+// checkGates enforces the deploy windows and protected flags of every
+// remote, as resolveRemote returns them, before anything is deployed, so
+// that a refused remote does not leave the earlier ones half done.
+// Protected remotes are not asked about when confirmed is set.
+func checkGates(remoteNames []string, remotes map[string]config.Remote, confirmed bool) error {
+	now := time.Now()
+	for _, name := range remoteNames {
+		window := remotes[name].DeployWindow
+		if window == nil {
+			continue
+		}
+
+		allowed, err := window.Allows(now)
+		if err != nil {
+			return fmt.Errorf("failed to check deploy window of %s: %w", name, err)
+		}
+		if allowed {
+			continue
+		}
+
+		if !overrideWindow {
+			return fmt.Errorf("remote %s only accepts deploys during %s; pass --override-window to deploy anyway", name, window)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: deploying to %s outside its deploy window (%s)\n", name, window)
+	}
+
+	for _, name := range remoteNames {
+		remote := remotes[name]
+		if !remote.Protected || confirmed {
+			continue
+		}
+
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("remote %s is protected; pass --yes to deploy without a terminal", name)
+		}
+
+		ok, err := confirmRemote(name, remote)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("deploy to %s not confirmed", name)
+		}
+	}
+
+	return nil
+}
+
+func confirmRemote(name string, remote config.Remote) (bool, error) {
+	var confirmed bool
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title(fmt.Sprintf("Deploy to protected remote %s?", name)).
+				Description(remote.ConfirmMessage).
+				Value(&confirmed),
+		),
+	)
+
+	if err := form.Run(); err != nil {
+		return false, fmt.Errorf("failed to confirm deploy to %s: %w", name, err)
+	}
+
+	return confirmed, nil
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"deeployer/internal/config"
+	"deeployer/internal/git"
+)
+
+// checkGit returns the commit being deployed, ref or else HEAD, and, when
+// enforce is set, checks it against the project's git policy, reporting
+// every unmet requirement at once. A project outside a git repository has
+// no commit, which is only an error when it has a policy or a ref is given.
+func checkGit(project config.Project, ref string, enforce bool) (*git.Commit, error) {
+	policy := project.Git
+
+	rev := "HEAD"
+	if ref != "" {
+		rev = ref
+	}
+
+	head, err := git.Resolve(project.Path, rev)
+	if err != nil {
+		if policy == nil && ref == "" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to resolve git commit %s: %w", rev, err)
+	}
+
+	if !enforce || policy == nil {
+		return &head, nil
+	}
+
+	var problems []string
+
+	// A ref is built in a fresh checkout, so only HEAD can have changes
+	if policy.RequireClean && ref == "" {
+		if dirty, err := git.Dirty(project.Path); err != nil {
+			problems = append(problems, err.Error())
+		} else if dirty {
+			problems = append(problems, "the working tree has uncommitted changes")
+		}
+	}
+
+	if policy.RequireBranch != "" {
+		if ref == "" {
+			if branch, err := git.Branch(project.Path); err != nil {
+				problems = append(problems, err.Error())
+			} else if branch == "" {
+				problems = append(problems, fmt.Sprintf("HEAD is detached, not on branch %s", policy.RequireBranch))
+			} else if branch != policy.RequireBranch {
+				problems = append(problems, fmt.Sprintf("on branch %s, not %s", branch, policy.RequireBranch))
+			}
+		} else {
+			if branches, err := git.Branches(project.Path, head.SHA, false); err != nil {
+				problems = append(problems, err.Error())
+			} else if !slices.Contains(branches, policy.RequireBranch) {
+				problems = append(problems, fmt.Sprintf("%s is not on branch %s", ref, policy.RequireBranch))
+			}
+		}
+	}
+
+	if policy.RequirePushed {
+		if ref == "" {
+			if count, err := git.Unpushed(project.Path); err != nil {
+				problems = append(problems, err.Error())
+			} else if count > 0 {
+				problems = append(problems, fmt.Sprintf("%d commit(s) not pushed to the upstream branch", count))
+			}
+		} else {
+			if branches, err := git.Branches(project.Path, head.SHA, true); err != nil {
+				problems = append(problems, err.Error())
+			} else if len(branches) == 0 {
+				problems = append(problems, fmt.Sprintf("%s is not on any remote branch", ref))
+			}
+		}
+	}
+
+	if policy.RequireSigned {
+		if signed, err := git.Signed(project.Path, head.SHA); err != nil {
+			problems = append(problems, err.Error())
+		} else if !signed {
+			problems = append(problems, fmt.Sprintf("commit %s has no good signature", head.Short))
+		}
+	}
+
+	if policy.RequireTag {
+		if tags, err := git.Tags(project.Path, head.SHA); err != nil {
+			problems = append(problems, err.Error())
+		} else if len(tags) == 0 {
+			problems = append(problems, fmt.Sprintf("commit %s is not tagged", head.Short))
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("git checks failed for commit %s:\n  %s", head.Short, strings.Join(problems, "\n  "))
+	}
+
+	return &head, nil
+}
+
+// checkoutRef checks out commit in a temporary worktree and returns the
+// project moved into it, along with a function that removes the worktree.
+func checkoutRef(project config.Project, commit git.Commit) (config.Project, func(), error) {
+	projectPath, err := filepath.Abs(project.Path)
+	if err != nil {
+		return project, nil, fmt.Errorf("failed to get absolute project path: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(projectPath); err == nil {
+		projectPath = resolved
+	}
+
+	root, err := git.Root(projectPath)
+	if err != nil {
+		return project, nil, err
+	}
+
+	// The project may live in a subdirectory of its repository
+	rel, err := filepath.Rel(root, projectPath)
+	if err != nil {
+		return project, nil, fmt.Errorf("failed to locate project in its repository: %w", err)
+	}
+
+	worktree, err := git.AddWorktree(root, commit.SHA)
+	if err != nil {
+		return project, nil, fmt.Errorf("failed to check out %s: %w", commit.Short, err)
+	}
+
+	cleanup := func() {
+		if err := git.RemoveWorktree(root, worktree); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to remove worktree %s: %v\n", worktree, err)
+		}
+	}
+
+	project.Path = filepath.Join(worktree, rel)
+	return project, cleanup, nil
+}
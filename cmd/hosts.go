@@ -0,0 +1,238 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"deeployer/internal/config"
+	"deeployer/internal/ssh"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+)
+
+var trustYes bool
+
+var hostsCmd = &cobra.Command{
+	Use:   "hosts",
+	Short: "Manage SSH host keys of configured remotes",
+	Long: `Inspect, trust and forget the SSH host keys of configured remotes.
+
+Keys are stored in ~/.ssh/known_hosts, so they are shared with the system ssh
+used by rsync. Remotes may pin expected keys with host_key_fingerprints.`,
+}
+
+var hostsScanCmd = &cobra.Command{
+	Use:   "scan [remote...]",
+	Short: "Show the host key presented by each remote",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		remoteNames, err := hostsRemoteNames(cfg, args)
+		if err != nil {
+			return err
+		}
+
+		sshClient := ssh.New(false, false)
+		sshClient.Output = newSink()
+		for _, name := range remoteNames {
+			target := sshTarget(cfg.Remotes[name])
+
+			key, err := sshClient.ScanHostKey(target)
+			if err != nil {
+				fmt.Fprintf(humanOutput, "%s (%s): %v\n", name, target.Host, err)
+				continue
+			}
+
+			status, err := ssh.CheckHostKey(target, key)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(humanOutput, "%s (%s): %s %s [%s]\n", name, target.Host, key.Type(), ssh.Fingerprint(key), status)
+		}
+
+		return nil
+	},
+}
+
+var hostsTrustCmd = &cobra.Command{
+	Use:   "trust [remote...]",
+	Short: "Add the host key of each remote to known_hosts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		remoteNames, err := hostsRemoteNames(cfg, args)
+		if err != nil {
+			return err
+		}
+
+		sshClient := ssh.New(false, false)
+		sshClient.Output = newSink()
+		for _, name := range remoteNames {
+			target := sshTarget(cfg.Remotes[name])
+
+			key, err := sshClient.ScanHostKey(target)
+			if err != nil {
+				return err
+			}
+
+			status, err := ssh.CheckHostKey(target, key)
+			if err != nil {
+				return err
+			}
+
+			switch status {
+			case ssh.HostKeyTrusted:
+				fmt.Fprintf(humanOutput, "%s (%s): already trusted\n", name, target.Host)
+				continue
+			case ssh.HostKeyMismatch:
+				return fmt.Errorf("host key for %s differs from known_hosts; run 'deeployer hosts forget %s' first", name, name)
+			case ssh.HostKeyPinMismatch:
+				return fmt.Errorf("host key for %s (%s) does not match any pinned fingerprint", name, ssh.Fingerprint(key))
+			}
+
+			// Keys matching a pinned fingerprint need no confirmation
+			if len(target.HostKeyFingerprints) == 0 && !trustYes {
+				var trusted bool
+				form := huh.NewForm(
+					huh.NewGroup(
+						huh.NewConfirm().
+							Title(fmt.Sprintf("Trust host key of %s (%s)?", name, target.Host)).
+							Description(fmt.Sprintf("%s key fingerprint is %s", key.Type(), ssh.Fingerprint(key))).
+							Value(&trusted),
+					),
+				)
+
+				if err := form.Run(); err != nil {
+					return fmt.Errorf("failed to confirm host key: %w", err)
+				}
+
+				if !trusted {
+					fmt.Fprintf(humanOutput, "%s (%s): skipped\n", name, target.Host)
+					continue
+				}
+			}
+
+			if err := ssh.TrustHostKey(target.Host, key); err != nil {
+				return fmt.Errorf("failed to trust host key for %s: %w", name, err)
+			}
+
+			fmt.Fprintf(humanOutput, "%s (%s): trusted %s %s\n", name, target.Host, key.Type(), ssh.Fingerprint(key))
+		}
+
+		return nil
+	},
+}
+
+var hostsForgetCmd = &cobra.Command{
+	Use:   "forget [remote...]",
+	Short: "Remove the host keys of each remote from known_hosts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		remoteNames, err := hostsRemoteNames(cfg, args)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range remoteNames {
+			remote := cfg.Remotes[name]
+
+			removed, err := ssh.ForgetHostKey(remote.Host)
+			if err != nil {
+				return fmt.Errorf("failed to forget host key for %s: %w", name, err)
+			}
+
+			fmt.Fprintf(humanOutput, "%s (%s): removed %d known_hosts line(s)\n", name, remote.Host, removed)
+		}
+
+		return nil
+	},
+}
+
+var hostsVerifyCmd = &cobra.Command{
+	Use:   "verify [remote...]",
+	Short: "Check that every remote presents a trusted host key",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		remoteNames, err := hostsRemoteNames(cfg, args)
+		if err != nil {
+			return err
+		}
+
+		sshClient := ssh.New(false, false)
+		sshClient.Output = newSink()
+		failed := 0
+		for _, name := range remoteNames {
+			target := sshTarget(cfg.Remotes[name])
+
+			key, err := sshClient.ScanHostKey(target)
+			if err != nil {
+				fmt.Fprintf(humanOutput, "✗ %s (%s): %v\n", name, target.Host, err)
+				failed++
+				continue
+			}
+
+			status, err := ssh.CheckHostKey(target, key)
+			if err != nil {
+				return err
+			}
+
+			if status != ssh.HostKeyTrusted {
+				fmt.Fprintf(humanOutput, "✗ %s (%s): %s %s [%s]\n", name, target.Host, key.Type(), ssh.Fingerprint(key), status)
+				failed++
+				continue
+			}
+
+			fmt.Fprintf(humanOutput, "✓ %s (%s): %s %s\n", name, target.Host, key.Type(), ssh.Fingerprint(key))
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d remote(s) failed host key verification", failed, len(remoteNames))
+		}
+
+		return nil
+	},
+}
+
+// hostsRemoteNames returns the requested remotes, or every configured remote
+// in name order when none are given.
+func hostsRemoteNames(cfg *config.Config, args []string) ([]string, error) {
+	if len(args) > 0 {
+		for _, name := range args {
+			if _, exists := cfg.Remotes[name]; !exists {
+				return nil, fmt.Errorf("remote '%s' not found in configuration", name)
+			}
+		}
+		return args, nil
+	}
+
+	remoteNames := make([]string, 0, len(cfg.Remotes))
+	for name := range cfg.Remotes {
+		remoteNames = append(remoteNames, name)
+	}
+	sort.Strings(remoteNames)
+
+	return remoteNames, nil
+}
+
+func init() {
+	rootCmd.AddCommand(hostsCmd)
+	hostsCmd.AddCommand(hostsScanCmd, hostsTrustCmd, hostsForgetCmd, hostsVerifyCmd)
+
+	hostsTrustCmd.Flags().BoolVarP(&trustYes, "yes", "y", false, "Trust unknown host keys without asking")
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// interrupter turns the first SIGINT or SIGTERM into a request to stop, so
+// that a deploy can finish its current step and clean up, and exits on the
+// second.
+type interrupter struct {
+	c       chan struct{}
+	once    sync.Once
+	signals chan os.Signal
+	stop    chan struct{}
+}
+
+func catchInterrupts() *interrupter {
+	i := &interrupter{
+		c:       make(chan struct{}),
+		signals: make(chan os.Signal, 1),
+		stop:    make(chan struct{}),
+	}
+	signal.Notify(i.signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-i.signals:
+		case <-i.stop:
+			return
+		}
+		fmt.Fprintln(os.Stderr, "\nInterrupted: stopping after the current step and cleaning up. Interrupt again to quit now.")
+		i.Interrupt()
+
+		select {
+		case <-i.signals:
+			os.Exit(130)
+		case <-i.stop:
+		}
+	}()
+
+	return i
+}
+
+// Done is closed once an interrupt has been requested.
+func (i *interrupter) Done() <-chan struct{} {
+	return i.c
+}
+
+// Interrupt requests a stop, as a signal would.
+func (i *interrupter) Interrupt() {
+	i.once.Do(func() { close(i.c) })
+}
+
+// Stop restores the default handling of signals.
+func (i *interrupter) Stop() {
+	signal.Stop(i.signals)
+	close(i.stop)
+}
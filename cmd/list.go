@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"deeployer/internal/config"
+	"deeployer/pkg/api"
 
 	"github.com/spf13/cobra"
 )
@@ -20,8 +21,12 @@ var listCmd = &cobra.Command{
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
+		if outputFormat != outputText {
+			return writeResult(listResult(cfg))
+		}
+
 		listProjects(cfg)
-		fmt.Println()
+		fmt.Fprintln(humanOutput)
 		listRemotes(cfg)
 
 		return nil
@@ -29,11 +34,11 @@ var listCmd = &cobra.Command{
 }
 
 func listProjects(cfg *config.Config) {
-	fmt.Println("Projects:")
-	fmt.Println("=========")
+	fmt.Fprintln(humanOutput, "Projects:")
+	fmt.Fprintln(humanOutput, "=========")
 
 	if len(cfg.Projects) == 0 {
-		fmt.Println("No projects configured")
+		fmt.Fprintln(humanOutput, "No projects configured")
 		return
 	}
 
@@ -45,23 +50,70 @@ func listProjects(cfg *config.Config) {
 
 	for _, name := range projectNames {
 		project := cfg.Projects[name]
-		fmt.Printf("\n%s:\n", name)
-		fmt.Printf("  Path: %s\n", project.Path)
-		fmt.Printf("  Output Directory: %s\n", project.OutputDir)
-		fmt.Printf("  Build Commands: %s\n", formatCommands(project.BuildCommands))
+		fmt.Fprintf(humanOutput, "\n%s:\n", name)
+		fmt.Fprintf(humanOutput, "  Path: %s\n", project.Path)
+		if len(project.Sync) > 0 {
+			printSync(project.Sync)
+		} else {
+			fmt.Fprintf(humanOutput, "  Output Directory: %s\n", project.OutputDir)
+		}
+		if permissions := formatPermissions(project.Permissions); permissions != "" {
+			fmt.Fprintf(humanOutput, "  Permissions: %s\n", permissions)
+		}
+		fmt.Fprintf(humanOutput, "  Build Commands: %s\n", formatCommands(project.BuildCommands))
+		if project.BuildImage != "" {
+			fmt.Fprintf(humanOutput, "  Build Image: %s\n", project.BuildImage)
+		}
+		if project.BuildRuntime != "" {
+			fmt.Fprintf(humanOutput, "  Build Runtime: %s\n", project.BuildRuntime)
+		}
 		if len(project.PostCommands) > 0 {
-			fmt.Printf("  Post Commands: %s\n", formatCommands(project.PostCommands))
+			fmt.Fprintf(humanOutput, "  Post Commands: %s\n", formatCommands(project.PostCommands))
+		}
+		printHooks(project.Hooks)
+		if len(project.Exclude) > 0 {
+			fmt.Fprintf(humanOutput, "  Exclude: %s\n", strings.Join(project.Exclude, ", "))
+		}
+		if len(project.Include) > 0 {
+			fmt.Fprintf(humanOutput, "  Include: %s\n", strings.Join(project.Include, ", "))
+		}
+		if len(project.ExcludeFrom) > 0 {
+			fmt.Fprintf(humanOutput, "  Exclude From: %s\n", strings.Join(project.ExcludeFrom, ", "))
+		}
+		if project.Git != nil {
+			fmt.Fprintf(humanOutput, "  Git Policy: %s\n", formatGitPolicy(*project.Git))
+		}
+		fmt.Fprintf(humanOutput, "  Remotes: %s\n", strings.Join(project.Remotes, ", "))
+		printOverrides(cfg, project)
+	}
+}
+
+// printOverrides prints the effective settings of every remote the
+// project overrides.
+func printOverrides(cfg *config.Config, project config.Project) {
+	for _, name := range project.Remotes {
+		remote, exists := cfg.Remote(project, name)
+		if !exists || !project.Overrides[name].Overridden() {
+			continue
+		}
+		fmt.Fprintf(humanOutput, "    %s (overridden):\n", name)
+		fmt.Fprintf(humanOutput, "      Path: %s\n", remote.Path)
+		fmt.Fprintf(humanOutput, "      Rsync Options: %s\n", strings.Join(remote.RsyncOptions, " "))
+		if len(remote.PostCommands) > 0 {
+			fmt.Fprintf(humanOutput, "      Post Commands: %s\n", formatPostCommands(remote.PostCommands))
+		}
+		if len(remote.Env) > 0 {
+			fmt.Fprintf(humanOutput, "      Env: %s\n", strings.Join(remote.EnvList(), " "))
 		}
-		fmt.Printf("  Remotes: %s\n", strings.Join(project.Remotes, ", "))
 	}
 }
 
 func listRemotes(cfg *config.Config) {
-	fmt.Println("Remotes:")
-	fmt.Println("========")
+	fmt.Fprintln(humanOutput, "Remotes:")
+	fmt.Fprintln(humanOutput, "========")
 
 	if len(cfg.Remotes) == 0 {
-		fmt.Println("No remotes configured")
+		fmt.Fprintln(humanOutput, "No remotes configured")
 		return
 	}
 
@@ -73,14 +125,239 @@ func listRemotes(cfg *config.Config) {
 
 	for _, name := range remoteNames {
 		remote := cfg.Remotes[name]
-		fmt.Printf("\n%s:\n", name)
-		fmt.Printf("  Host: %s@%s\n", remote.User, remote.Host)
-		fmt.Printf("  Path: %s\n", remote.Path)
-		fmt.Printf("  Rsync Options: %s\n", strings.Join(remote.RsyncOptions, " "))
+		fmt.Fprintf(humanOutput, "\n%s:\n", name)
+		fmt.Fprintf(humanOutput, "  Host: %s@%s\n", remote.User, remote.Host)
+		fmt.Fprintf(humanOutput, "  Path: %s\n", remote.Path)
+		fmt.Fprintf(humanOutput, "  Rsync Options: %s\n", strings.Join(remote.RsyncOptions, " "))
+		if len(remote.Preserve) > 0 {
+			fmt.Fprintf(humanOutput, "  Preserve: %s\n", strings.Join(remote.Preserve, ", "))
+		}
 		if len(remote.PostCommands) > 0 {
-			fmt.Printf("  Post Commands: %s\n", formatCommands(remote.PostCommands))
+			fmt.Fprintf(humanOutput, "  Post Commands: %s\n", formatPostCommands(remote.PostCommands))
+		}
+		if len(remote.HealthChecks) > 0 {
+			fmt.Fprintf(humanOutput, "  Health Checks: %s\n", formatCommands(remote.HealthChecks))
+		}
+		if len(remote.Env) > 0 {
+			fmt.Fprintf(humanOutput, "  Env: %s\n", strings.Join(remote.EnvList(), " "))
+		}
+		printHooks(remote.Hooks)
+		if remote.PTY {
+			fmt.Fprintf(humanOutput, "  PTY: enabled\n")
+		}
+		if remote.Protected {
+			fmt.Fprintf(humanOutput, "  Protected: yes\n")
+		}
+		if remote.DeployWindow != nil {
+			fmt.Fprintf(humanOutput, "  Deploy Window: %s\n", remote.DeployWindow)
 		}
+		if len(remote.Auth) > 0 {
+			fmt.Fprintf(humanOutput, "  Auth: %s\n", strings.Join(remote.Auth, ", "))
+		}
+		if remote.IdentityFile != "" {
+			fmt.Fprintf(humanOutput, "  Identity File: %s\n", remote.IdentityFile)
+		}
+		if len(remote.HostKeyFingerprints) > 0 {
+			fmt.Fprintf(humanOutput, "  Host Key Fingerprints: %s\n", strings.Join(remote.HostKeyFingerprints, ", "))
+		}
+	}
+}
+
+func formatGitPolicy(policy config.GitPolicy) string {
+	var checks []string
+	if policy.RequireClean {
+		checks = append(checks, "clean")
 	}
+	if policy.RequireBranch != "" {
+		checks = append(checks, "branch "+policy.RequireBranch)
+	}
+	if policy.RequirePushed {
+		checks = append(checks, "pushed")
+	}
+	if policy.RequireSigned {
+		checks = append(checks, "signed")
+	}
+	if policy.RequireTag {
+		checks = append(checks, "tagged")
+	}
+	if len(checks) == 0 {
+		return "none"
+	}
+	return strings.Join(checks, ", ")
+}
+
+func printSync(mappings []config.SyncMapping) {
+	fmt.Fprintln(humanOutput, "  Sync:")
+	for _, mapping := range mappings {
+		dest := mapping.Dest
+		if dest == "" {
+			dest = "(remote path)"
+		}
+		fmt.Fprintf(humanOutput, "    %s -> %s\n", mapping.Source, dest)
+		if len(mapping.RsyncOptions) > 0 {
+			fmt.Fprintf(humanOutput, "      Rsync Options: %s\n", strings.Join(mapping.RsyncOptions, " "))
+		}
+		if len(mapping.Exclude) > 0 {
+			fmt.Fprintf(humanOutput, "      Exclude: %s\n", strings.Join(mapping.Exclude, ", "))
+		}
+		if len(mapping.Include) > 0 {
+			fmt.Fprintf(humanOutput, "      Include: %s\n", strings.Join(mapping.Include, ", "))
+		}
+		if permissions := formatPermissions(mapping.Permissions); permissions != "" {
+			fmt.Fprintf(humanOutput, "      Permissions: %s\n", permissions)
+		}
+	}
+}
+
+func formatPermissions(permissions config.Permissions) string {
+	var parts []string
+	if permissions.Owner != "" {
+		parts = append(parts, "owner "+permissions.Owner)
+	}
+	if permissions.Group != "" {
+		parts = append(parts, "group "+permissions.Group)
+	}
+	if permissions.DirMode != "" {
+		parts = append(parts, "dirs "+permissions.DirMode)
+	}
+	if permissions.FileMode != "" {
+		parts = append(parts, "files "+permissions.FileMode)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func apiSync(mappings []config.SyncMapping) []api.SyncMapping {
+	if len(mappings) == 0 {
+		return nil
+	}
+	result := make([]api.SyncMapping, 0, len(mappings))
+	for _, mapping := range mappings {
+		result = append(result, api.SyncMapping{
+			Source:       mapping.Source,
+			Dest:         mapping.Dest,
+			RsyncOptions: mapping.RsyncOptions,
+			Exclude:      mapping.Exclude,
+			Include:      mapping.Include,
+			Permissions:  api.Permissions(mapping.Permissions),
+		})
+	}
+	return result
+}
+
+func apiOverrides(cfg *config.Config, project config.Project) map[string]api.RemoteSettings {
+	var result map[string]api.RemoteSettings
+	for _, name := range project.Remotes {
+		remote, exists := cfg.Remote(project, name)
+		if !exists || !project.Overrides[name].Overridden() {
+			continue
+		}
+		if result == nil {
+			result = make(map[string]api.RemoteSettings)
+		}
+		result[name] = api.RemoteSettings{
+			Path:         remote.Path,
+			RsyncOptions: nonNil(remote.RsyncOptions),
+			PostCommands: config.Commands(remote.PostCommands),
+			Env:          remote.Env,
+		}
+	}
+	return result
+}
+
+func listResult(cfg *config.Config) api.ListResult {
+	result := api.ListResult{
+		Projects: make([]api.Project, 0, len(cfg.Projects)),
+		Remotes:  make([]api.Remote, 0, len(cfg.Remotes)),
+	}
+
+	for _, name := range sortedNames(cfg.Projects) {
+		project := cfg.Projects[name]
+		result.Projects = append(result.Projects, api.Project{
+			Name:          name,
+			Path:          project.Path,
+			OutputDir:     project.OutputDir,
+			BuildCommands: nonNil(project.BuildCommands),
+			PostCommands:  nonNil(project.PostCommands),
+			BuildImage:    project.BuildImage,
+			BuildRuntime:  project.BuildRuntime,
+			Hooks:         hookMap(project.Hooks),
+			Remotes:       nonNil(project.Remotes),
+			Exclude:       project.Exclude,
+			Include:       project.Include,
+			ExcludeFrom:   project.ExcludeFrom,
+			Git:           (*api.GitPolicy)(project.Git),
+			Sync:          apiSync(project.Sync),
+			Overrides:     apiOverrides(cfg, project),
+			Permissions:   api.Permissions(project.Permissions),
+		})
+	}
+
+	for _, name := range sortedNames(cfg.Remotes) {
+		remote := cfg.Remotes[name]
+		entry := api.Remote{
+			Name:                name,
+			Host:                remote.Host,
+			User:                remote.User,
+			Path:                remote.Path,
+			RsyncOptions:        nonNil(remote.RsyncOptions),
+			PostCommands:        config.Commands(remote.PostCommands),
+			HealthChecks:        remote.HealthChecks,
+			Hooks:               hookMap(remote.Hooks),
+			Preserve:            remote.Preserve,
+			HostKeyFingerprints: remote.HostKeyFingerprints,
+			Auth:                remote.Auth,
+			IdentityFile:        remote.IdentityFile,
+			PTY:                 remote.PTY,
+			Protected:           remote.Protected,
+			ConfirmMessage:      remote.ConfirmMessage,
+			Env:                 remote.Env,
+		}
+		if remote.DeployWindow != nil {
+			entry.DeployWindow = remote.DeployWindow.String()
+		}
+		result.Remotes = append(result.Remotes, entry)
+	}
+
+	return result
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// nonNil keeps empty lists as [] rather than null in JSON.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func printHooks(hooks config.Hooks) {
+	for _, name := range config.HookNames {
+		if commands := hooks.Commands(name); len(commands) > 0 {
+			fmt.Fprintf(humanOutput, "  Hook %s: %s\n", name, formatCommands(commands))
+		}
+	}
+}
+
+// hookMap returns the hooks that have commands, by name.
+func hookMap(hooks config.Hooks) map[string][]string {
+	result := make(map[string][]string)
+	for _, name := range config.HookNames {
+		if commands := hooks.Commands(name); len(commands) > 0 {
+			result[name] = commands
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
 }
 
 func formatCommands(commands []string) string {
@@ -93,6 +370,18 @@ func formatCommands(commands []string) string {
 	return fmt.Sprintf("[%s]", strings.Join(commands, ", "))
 }
 
+// formatPostCommands formats a remote's post commands, marking those run on
+// a terminal.
+func formatPostCommands(commands []config.RemoteCommand) string {
+	lines := config.Commands(commands)
+	for i, c := range commands {
+		if c.PTY {
+			lines[i] += " (pty)"
+		}
+	}
+	return formatCommands(lines)
+}
+
 func init() {
 	rootCmd.AddCommand(listCmd)
 }
\ No newline at end of file
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"deeployer/internal/config"
+	"deeployer/internal/plan"
+	"deeployer/internal/ssh"
+
+	"github.com/charmbracelet/huh"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var maintenanceProject string
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Turn maintenance mode on or off on remotes",
+	Long: `Turn maintenance mode on or off by hand, as configured in a remote's
+maintenance block. Deploys do this on their own around the sync.
+
+With --project, the remote's path is the one that project's overrides give
+it, so that a relative flag_file is the one its deploys create.`,
+}
+
+var maintenanceOnCmd = &cobra.Command{
+	Use:   "on [remote...]",
+	Short: "Turn maintenance mode on",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setMaintenance(args, true)
+	},
+}
+
+var maintenanceOffCmd = &cobra.Command{
+	Use:   "off [remote...]",
+	Short: "Turn maintenance mode off",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setMaintenance(args, false)
+	},
+}
+
+// setMaintenance runs the enable or disable commands on each remote, asking
+// for the remotes when none are given.
+func setMaintenance(args []string, enable bool) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	remoteNames := args
+	if len(remoteNames) == 0 {
+		remoteNames, err = selectMaintenanceRemotes(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	sshClient := ssh.New(false, verbose)
+	sshClient.Output = newSink()
+	defer sshClient.Close()
+
+	state := "off"
+	if enable {
+		state = "on"
+	}
+
+	var project config.Project
+	if maintenanceProject != "" {
+		var exists bool
+		project, exists = cfg.Projects[maintenanceProject]
+		if !exists {
+			return fmt.Errorf("project '%s' not found in configuration", maintenanceProject)
+		}
+	}
+
+	for _, name := range remoteNames {
+		var remote config.Remote
+		if maintenanceProject != "" {
+			remote, err = resolveRemote(cfg, maintenanceProject, project, name)
+			if err != nil {
+				return err
+			}
+		} else {
+			var exists bool
+			remote, exists = cfg.Remotes[name]
+			if !exists {
+				return fmt.Errorf("remote '%s' not found in configuration", name)
+			}
+		}
+		if remote.Maintenance == nil {
+			return fmt.Errorf("remote '%s' has no maintenance block", name)
+		}
+
+		// The same steps as a deploy's, so the remote's env is exported
+		enableSteps, disableSteps := maintenanceSteps(remote, planTarget(name, remote))
+		steps := disableSteps
+		if enable {
+			steps = enableSteps
+		}
+
+		for _, step := range steps {
+			if err := sshClient.Run(sshTarget(remote), step.RemoteCommand()); err != nil {
+				return fmt.Errorf("failed to turn %s maintenance mode on %s: %w", state, name, err)
+			}
+		}
+
+		fmt.Fprintf(humanOutput, "Turned %s maintenance mode on %s\n", state, name)
+	}
+
+	return nil
+}
+
+func selectMaintenanceRemotes(cfg *config.Config) ([]string, error) {
+	var options []string
+	for _, name := range sortedNames(cfg.Remotes) {
+		if cfg.Remotes[name].Maintenance != nil {
+			options = append(options, name)
+		}
+	}
+	if len(options) == 0 {
+		return nil, fmt.Errorf("no remote has a maintenance block")
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, fmt.Errorf("remote not given; pass it as an argument when not running in a terminal")
+	}
+
+	var remoteNames []string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title("Remotes").
+				Options(huh.NewOptions(options...)...).
+				Value(&remoteNames),
+		),
+	)
+
+	if err := form.Run(); err != nil {
+		return nil, fmt.Errorf("failed to select remotes: %w", err)
+	}
+	if len(remoteNames) == 0 {
+		return nil, fmt.Errorf("no remote selected")
+	}
+
+	return remoteNames, nil
+}
+
+// maintenanceSteps returns the steps on target that turn maintenance mode on
+// and off, or nothing when the remote has no maintenance block.
+func maintenanceSteps(remote config.Remote, target plan.Target) (enable, disable []plan.Step) {
+	enableCommands, disableCommands := maintenanceCommands(remote)
+	return plan.RemoteSteps(enableCommands, target), plan.RemoteSteps(disableCommands, target)
+}
+
+// maintenanceCommands returns the remote commands that turn maintenance mode
+// on and off, or nothing when the remote has no maintenance block.
+func maintenanceCommands(remote config.Remote) (enable, disable []string) {
+	m := remote.Maintenance
+	if m == nil {
+		return nil, nil
+	}
+
+	if m.FlagFile == "" {
+		return m.Enable, m.Disable
+	}
+
+	flagFile := maintenanceFlagFile(remote)
+	enable = []string{fmt.Sprintf("mkdir -p %s && touch %s", ssh.Quote(path.Dir(flagFile)), ssh.Quote(flagFile))}
+	disable = []string{"rm -f " + ssh.Quote(flagFile)}
+	return enable, disable
+}
+
+// maintenanceFlagFile returns the absolute path of the remote's maintenance
+// flag file, or "" when it has none.
+func maintenanceFlagFile(remote config.Remote) string {
+	m := remote.Maintenance
+	if m == nil || m.FlagFile == "" {
+		return ""
+	}
+	if path.IsAbs(m.FlagFile) {
+		return m.FlagFile
+	}
+	return path.Join(remote.Path, m.FlagFile)
+}
+
+// relativeFlagFile returns the remote's maintenance flag file relative to
+// the remote path, or "" when it has none there.
+func relativeFlagFile(remote config.Remote) string {
+	flagFile := maintenanceFlagFile(remote)
+	if flagFile == "" {
+		return ""
+	}
+	if relPath, inside := remotePrefix(remote.Path, flagFile); inside {
+		return relPath
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(maintenanceCmd)
+	maintenanceCmd.AddCommand(maintenanceOnCmd, maintenanceOffCmd)
+
+	maintenanceCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	maintenanceCmd.PersistentFlags().StringVar(&maintenanceProject, "project", "", "Apply this project's overrides to the remotes")
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"deeployer/internal/output"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Values accepted by --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+var (
+	outputFormat string
+	// resultOutput receives the machine-readable result.
+	resultOutput io.Writer = os.Stdout
+	// humanOutput receives everything meant for people, including the
+	// verbose logs of the clients created with newSink.
+	humanOutput io.Writer = os.Stdout
+)
+
+// setupOutput checks --output. With a machine-readable format, or events
+// streamed to stdout, everything meant for people goes to stderr so that
+// stdout carries nothing but the data.
+func setupOutput() error {
+	switch outputFormat {
+	case outputText:
+		if eventsOnStdout() {
+			humanOutput = os.Stderr
+		}
+		return nil
+	case outputJSON, outputYAML:
+		humanOutput = os.Stderr
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q: expected text, json or yaml", outputFormat)
+	}
+}
+
+// newSink returns a sink writing to humanOutput, for the clients of
+// commands that do not show a dashboard.
+func newSink() *output.Sink {
+	return output.NewSink(humanOutput, output.DefaultLimit)
+}
+
+// writeResult prints v, one of the types in pkg/api, in the selected
+// machine-readable format.
+func writeResult(v any) error {
+	switch outputFormat {
+	case outputJSON:
+		encoder := json.NewEncoder(resultOutput)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case outputYAML:
+		encoder := yaml.NewEncoder(resultOutput)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("output format %q is not machine-readable", outputFormat)
+	}
+}
@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"text/tabwriter"
+
+	"deeployer/internal/config"
+	"deeployer/internal/manifest"
+	"deeployer/internal/ssh"
+	"deeployer/pkg/api"
+
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [project] [remote...]",
+	Short: "Show the release running on each remote",
+	Long: `Read the release manifest that every deploy writes to the remote and show,
+for each remote, the deployed commit and ref, who deployed it and when, and a
+hash of the synced files.
+
+Remotes of the same project running different files are flagged as drifted.
+Without arguments, every project and all of its remotes are shown.`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		projectNames := sortedNames(cfg.Projects)
+		if len(args) > 0 {
+			if _, exists := cfg.Projects[args[0]]; !exists {
+				return fmt.Errorf("project '%s' not found in configuration", args[0])
+			}
+			projectNames = args[:1]
+		}
+
+		sshClient := ssh.New(false, verbose)
+		sshClient.Output = newSink()
+		defer sshClient.Close()
+
+		result := api.StatusResult{Projects: make([]api.ProjectStatus, 0, len(projectNames))}
+		for _, projectName := range projectNames {
+			project := cfg.Projects[projectName]
+
+			remoteNames := project.Remotes
+			if len(args) > 1 {
+				remoteNames = args[1:]
+			}
+
+			status, err := projectStatus(cfg, sshClient, projectName, project, remoteNames)
+			if err != nil {
+				return err
+			}
+			result.Projects = append(result.Projects, status)
+		}
+
+		if outputFormat != outputText {
+			return writeResult(result)
+		}
+
+		for i, status := range result.Projects {
+			if i > 0 {
+				fmt.Fprintln(humanOutput)
+			}
+			printStatus(status)
+		}
+		return nil
+	},
+}
+
+// projectStatus reads the manifest of each remote and flags the remotes
+// whose tree differs from the one most of them run.
+func projectStatus(cfg *config.Config, sshClient *ssh.Client, projectName string, project config.Project, remoteNames []string) (api.ProjectStatus, error) {
+	status := api.ProjectStatus{Project: projectName, Remotes: make([]api.RemoteStatus, 0, len(remoteNames))}
+
+	counts := make(map[string]int)
+	for _, remoteName := range remoteNames {
+		remote, err := resolveRemote(cfg, projectName, project, remoteName)
+		if err != nil {
+			return status, err
+		}
+
+		entry := api.RemoteStatus{Remote: remoteName}
+		m, err := readManifest(sshClient, remote)
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Manifest = apiManifest(m)
+			counts[m.TreeHash]++
+		}
+		status.Remotes = append(status.Remotes, entry)
+	}
+
+	// The first remote wins a tie, as remotes are usually listed from
+	// staging to production
+	var common string
+	for _, entry := range status.Remotes {
+		if entry.Manifest != nil && counts[entry.Manifest.TreeHash] > counts[common] {
+			common = entry.Manifest.TreeHash
+		}
+	}
+
+	for i, entry := range status.Remotes {
+		if entry.Manifest != nil && entry.Manifest.TreeHash != common {
+			status.Remotes[i].Drift = true
+			status.Drift = true
+		}
+	}
+
+	return status, nil
+}
+
+// readManifest returns the release manifest on the remote.
+func readManifest(sshClient *ssh.Client, remote config.Remote) (manifest.Manifest, error) {
+	data, err := sshClient.ReadFile(sshTarget(remote), path.Join(remote.Path, manifest.Path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest.Manifest{}, errors.New("no manifest found")
+	}
+	if err != nil {
+		return manifest.Manifest{}, err
+	}
+
+	return manifest.Parse(data)
+}
+
+// apiManifest converts a manifest to its machine-readable form, leaving out
+// the list of files.
+func apiManifest(m manifest.Manifest) *api.Manifest {
+	return &api.Manifest{
+		Project:      m.Project,
+		Remote:       m.Remote,
+		Commit:       m.Commit,
+		Ref:          m.Ref,
+		DeployedBy:   m.DeployedBy,
+		DeployedFrom: m.DeployedFrom,
+		DeployedAt:   m.DeployedAt,
+		TreeHash:     m.TreeHash,
+	}
+}
+
+func printStatus(status api.ProjectStatus) {
+	fmt.Fprintf(humanOutput, "%s:\n", status.Project)
+
+	w := tabwriter.NewWriter(humanOutput, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  REMOTE\tCOMMIT\tREF\tTREE\tDEPLOYED\tBY\t")
+	for _, entry := range status.Remotes {
+		m := entry.Manifest
+		if m == nil {
+			// Text after the last tab does not widen the columns
+			fmt.Fprintf(w, "  %s\t-\t-\t-\t-\t-\t%s\n", entry.Remote, entry.Error)
+			continue
+		}
+
+		line := fmt.Sprintf("  %s\t%s\t%s\t%s\t%s\t%s@%s\t",
+			entry.Remote, orDash(shortHash(m.Commit, 7)), orDash(m.Ref),
+			shortHash(strings.TrimPrefix(m.TreeHash, "sha256:"), 12),
+			m.DeployedAt.Local().Format("2006-01-02 15:04"), m.DeployedBy, m.DeployedFrom)
+		if entry.Drift {
+			line += "drift"
+		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+
+	if status.Drift {
+		fmt.Fprintln(humanOutput, "Remotes are running different files; deploy the same release to each to fix the drift")
+	}
+}
+
+func shortHash(hash string, n int) string {
+	if len(hash) > n {
+		return hash[:n]
+	}
+	return hash
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	statusCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+}
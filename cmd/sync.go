@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"deeployer/internal/config"
+	"deeployer/internal/ignore"
+	"deeployer/internal/manifest"
+	"deeployer/internal/rsync"
+	"deeployer/internal/ssh"
+)
+
+// syncTarget is one of a project's sync mappings resolved against a remote.
+type syncTarget struct {
+	// Source is the local file or directory, and Dir is set when it is a
+	// directory.
+	Source string
+	Dir    bool
+	// Dest is the path on the remote, ending with a slash when a file is
+	// synced into it.
+	Dest string
+	// Prefix is Dest relative to the remote path, or Dest itself when it
+	// lies outside the remote path.
+	Prefix string
+	Inside bool
+
+	Options []string
+	Rules   *ignore.Rules
+	Filters []string
+
+	// Permissions are set with rsync options where possible and otherwise
+	// by Fixup, remote commands run after the sync.
+	Permissions config.Permissions
+	Fixup       []string
+}
+
+// resolveSyncs resolves every sync mapping of the project on the remote,
+// refusing any source that would lead outside the project.
+func resolveSyncs(project config.Project, remote config.Remote) ([]syncTarget, error) {
+	mappings := project.Mappings()
+	targets := make([]syncTarget, 0, len(mappings))
+
+	for _, mapping := range mappings {
+		source, err := resolveSource(project, mapping.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		dir, err := sourceIsDir(source, mapping.Source, len(project.Sync) == 0)
+		if err != nil {
+			return nil, err
+		}
+
+		rules, err := loadRules(project, mapping)
+		if err != nil {
+			return nil, err
+		}
+
+		dest := mapping.DestPath(remote.Path)
+		options := mapping.Options(remote)
+		if err := remote.CheckDest(dest, options); err != nil {
+			return nil, err
+		}
+
+		prefix, inside := remotePrefix(remote.Path, dest)
+		targets = append(targets, syncTarget{
+			Source:      source,
+			Dir:         dir,
+			Dest:        dest,
+			Prefix:      prefix,
+			Inside:      inside,
+			Options:     permissionOptions(options, mapping.Permissions, remote),
+			Rules:       rules,
+			Permissions: mapping.Permissions,
+		})
+	}
+
+	for i := range targets {
+		protected := protectedPaths(targets[i], remote, targets)
+		targets[i].Filters = syncFilters(targets[i], protected)
+		targets[i].Fixup = fixupCommands(targets[i], remote, protected)
+	}
+
+	return targets, nil
+}
+
+// resolveSource returns the path of a sync source, refusing any that would
+// lead outside the project.
+func resolveSource(project config.Project, source string) (string, error) {
+	// Validate the source doesn't contain directory traversal
+	if config.HasTraversal(source) {
+		return "", fmt.Errorf("sync source contains directory traversal: %s", source)
+	}
+
+	sourcePath := filepath.Join(project.Path, source)
+	// Clean the path to resolve any remaining . or .. elements
+	sourcePath = filepath.Clean(sourcePath)
+
+	// Ensure the cleaned path is still within the project directory
+	projectAbsPath, err := filepath.Abs(project.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute project path: %w", err)
+	}
+
+	sourceAbsPath, err := filepath.Abs(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute source path: %w", err)
+	}
+
+	rel, err := filepath.Rel(projectAbsPath, sourceAbsPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("sync source is outside project directory: %s", sourceAbsPath)
+	}
+
+	return sourcePath, nil
+}
+
+// remotePrefix returns dest relative to the remote path, keeping a trailing
+// slash, and whether it lies inside the remote path at all.
+func remotePrefix(remotePath, dest string) (string, bool) {
+	root := path.Clean(remotePath)
+	dir := strings.TrimSuffix(dest, "/")
+	slash := ""
+	if strings.HasSuffix(dest, "/") {
+		slash = "/"
+	}
+
+	switch {
+	case dir == root:
+		return "", true
+	case root == "/":
+		return strings.TrimPrefix(dir, "/") + slash, true
+	case strings.HasPrefix(dir, root+"/"):
+		return strings.TrimPrefix(dir, root+"/") + slash, true
+	}
+	return dest, false
+}
+
+// fileDest returns the remote path a file source is synced to.
+func (t syncTarget) fileDest() string {
+	if strings.HasSuffix(t.Dest, "/") || (t.Inside && t.Prefix == "") {
+		return t.Dest + filepath.Base(t.Source)
+	}
+	return t.Dest
+}
+
+// relPath returns where a file the target synced, at relPath inside it,
+// ends up relative to the remote path.
+func (t syncTarget) relPath(relPath string) string {
+	if !t.Dir {
+		return manifest.FilePath(t.Prefix, t.Source)
+	}
+	joined := path.Join(t.Prefix, relPath)
+	if strings.HasSuffix(relPath, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// contains reports whether relPath, relative to the remote path, was
+// synced by the target and returns it relative to the target.
+func (t syncTarget) contains(relPath string) (string, bool) {
+	if !t.Inside {
+		return "", false
+	}
+	if !t.Dir {
+		return "", relPath == manifest.FilePath(t.Prefix, t.Source)
+	}
+
+	dir := strings.TrimSuffix(t.Prefix, "/")
+	if dir == "" {
+		return relPath, true
+	}
+	if rest, ok := strings.CutPrefix(relPath, dir+"/"); ok {
+		return rest, true
+	}
+	return "", false
+}
+
+// sourceIsDir reports whether the sync source at sourcePath, written as
+// source in the config, is a directory. One that the build has yet to
+// create is taken for a file, unless it is the output directory or source
+// ends with a slash.
+func sourceIsDir(sourcePath, source string, outputDir bool) (bool, error) {
+	slash := strings.HasSuffix(source, "/")
+
+	info, err := os.Stat(sourcePath)
+	if os.IsNotExist(err) {
+		return outputDir || slash, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check sync source: %w", err)
+	}
+	if slash && !info.IsDir() {
+		return false, fmt.Errorf("sync source ends with a slash but is a file: %s", source)
+	}
+	return info.IsDir(), nil
+}
+
+// loadRules returns the exclude rules of one of the project's mappings.
+func loadRules(project config.Project, mapping config.SyncMapping) (*ignore.Rules, error) {
+	exclude := append(slices.Clone(project.Exclude), mapping.Exclude...)
+	include := append(slices.Clone(project.Include), mapping.Include...)
+
+	rules, err := ignore.Load(project.Path, project.ExcludeFrom, exclude, include)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exclude rules: %w", err)
+	}
+	return rules, nil
+}
+
+// protectedPaths returns the paths inside the target, relative to it, that
+// its sync must leave alone: the remote's preserved paths, the release
+// manifest, the maintenance flag file and the other targets synced inside
+// it.
+func protectedPaths(target syncTarget, remote config.Remote, targets []syncTarget) []string {
+	// Preserved paths and the manifest are relative to the remote path
+	protect := append(slices.Clone(remote.Preserve), manifest.Dir+"/")
+	// The flag file is created before the sync and must outlive it
+	if flagFile := relativeFlagFile(remote); flagFile != "" {
+		protect = append(protect, flagFile)
+	}
+	for _, other := range targets {
+		if other.Inside && other.Prefix != "" && other.Dest != target.Dest {
+			protect = append(protect, other.Prefix)
+		}
+	}
+
+	var kept []string
+	for _, p := range protect {
+		if rest, ok := target.contains(strings.TrimPrefix(p, "/")); ok && target.Dir {
+			kept = append(kept, rest)
+		}
+	}
+	return kept
+}
+
+// syncFilters returns the rsync filter rules for syncing the target: its
+// protected paths followed by its excludes.
+func syncFilters(target syncTarget, protected []string) []string {
+	// Protect rules go first so that no later rule can expose a preserved
+	// path to --delete
+	return append(rsync.ProtectFilters(protected), target.Rules.RsyncFilters()...)
+}
+
+// permissionOptions adds the rsync options setting permissions. Only root
+// can give files away, so for anyone else ownership is left to the fixup.
+func permissionOptions(options []string, permissions config.Permissions, remote config.Remote) []string {
+	var extra []string
+	if chown := permissions.Chown(); chown != "" && remote.User == "root" {
+		extra = append(extra, "--chown="+chown)
+	}
+	if chmod := permissions.Chmod(); chmod != "" {
+		extra = append(extra, "--chmod="+chmod)
+	}
+	if len(extra) == 0 {
+		return options
+	}
+	return append(slices.Clone(options), extra...)
+}
+
+// fixupCommands returns the remote commands giving the target's files
+// their owner when rsync could not, skipping its protected paths.
+func fixupCommands(target syncTarget, remote config.Remote, protected []string) []string {
+	chown := target.Permissions.Chown()
+	if chown == "" || remote.User == "root" {
+		return nil
+	}
+
+	dest := strings.TrimSuffix(target.Dest, "/")
+	if !target.Dir {
+		dest = strings.TrimSuffix(target.fileDest(), "/")
+	}
+
+	command := "sudo find " + ssh.Quote(dest)
+	if len(protected) > 0 {
+		prune := make([]string, 0, len(protected))
+		for _, p := range protected {
+			prune = append(prune, "-path "+ssh.Quote(path.Join(dest, p)))
+		}
+		command += ` \( ` + strings.Join(prune, " -o ") + ` \) -prune -o`
+	}
+	command += " -exec chown -h " + ssh.Quote(chown) + " {} +"
+
+	return []string{command}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"deeployer/internal/config"
+	"deeployer/pkg/api"
 
 	"github.com/spf13/cobra"
 )
@@ -11,38 +12,96 @@ import (
 var validateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validate the configuration file",
-	Long:  `Check the configuration file for syntax errors and validate all projects and remotes.`,
+	Long: `Check the configuration file for syntax errors and validate all projects and remotes.
+
+Every problem is reported, not just the first. Warnings point at settings that
+are valid but likely mistakes and do not make validation fail.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		configPath, err := config.GetConfigPath()
 		if err != nil {
 			return fmt.Errorf("failed to get config path: %w", err)
 		}
 
-		fmt.Printf("Validating configuration file: %s\n", configPath)
+		if outputFormat == outputText {
+			fmt.Fprintf(humanOutput, "Validating configuration file: %s\n", configPath)
+		}
 
-		cfg, err := config.Load()
+		cfg, err := config.Parse()
 		if err != nil {
+			if outputFormat != outputText {
+				cmd.SilenceUsage = true
+				result := api.ValidateResult{
+					ConfigPath: configPath,
+					Errors:     []api.Issue{{Message: err.Error()}},
+					Warnings:   []api.Issue{},
+				}
+				if writeErr := writeResult(result); writeErr != nil {
+					return writeErr
+				}
+			}
 			return fmt.Errorf("✗ Configuration validation failed: %w", err)
 		}
 
-		fmt.Println("✓ Configuration is valid")
-		
-		fmt.Printf("✓ Found %d project(s)\n", len(cfg.Projects))
-		fmt.Printf("✓ Found %d remote(s)\n", len(cfg.Remotes))
+		result := api.ValidateResult{
+			ConfigPath: configPath,
+			Errors:     []api.Issue{},
+			Warnings:   []api.Issue{},
+		}
+		for _, issue := range cfg.Check() {
+			entry := api.Issue{Path: issue.Path, Message: issue.Message}
+			if issue.Severity == config.SeverityError {
+				result.Errors = append(result.Errors, entry)
+			} else {
+				result.Warnings = append(result.Warnings, entry)
+			}
+		}
+		result.Valid = len(result.Errors) == 0
 
-		for projectName, project := range cfg.Projects {
-			fmt.Printf("✓ Project '%s': %d build command(s), %d post command(s), %d remote(s)\n", 
-				projectName, len(project.BuildCommands), len(project.PostCommands), len(project.Remotes))
+		if outputFormat != outputText {
+			if err := writeResult(result); err != nil {
+				return err
+			}
+		} else {
+			printValidation(cfg, result)
 		}
 
-		for remoteName := range cfg.Remotes {
-			fmt.Printf("✓ Remote '%s' configured\n", remoteName)
+		if !result.Valid {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("✗ Configuration validation failed: %d error(s)", len(result.Errors))
 		}
 
 		return nil
 	},
 }
 
+func printValidation(cfg *config.Config, result api.ValidateResult) {
+	for _, issue := range result.Errors {
+		fmt.Fprintf(humanOutput, "✗ %s: %s\n", issue.Path, issue.Message)
+	}
+	for _, issue := range result.Warnings {
+		fmt.Fprintf(humanOutput, "! %s: %s\n", issue.Path, issue.Message)
+	}
+
+	if !result.Valid {
+		return
+	}
+
+	fmt.Fprintln(humanOutput, "✓ Configuration is valid")
+
+	fmt.Fprintf(humanOutput, "✓ Found %d project(s)\n", len(cfg.Projects))
+	fmt.Fprintf(humanOutput, "✓ Found %d remote(s)\n", len(cfg.Remotes))
+
+	for _, projectName := range sortedNames(cfg.Projects) {
+		project := cfg.Projects[projectName]
+		fmt.Fprintf(humanOutput, "✓ Project '%s': %d build command(s), %d post command(s), %d remote(s)\n",
+			projectName, len(project.BuildCommands), len(project.PostCommands), len(project.Remotes))
+	}
+
+	for _, remoteName := range sortedNames(cfg.Remotes) {
+		fmt.Fprintf(humanOutput, "✓ Remote '%s' configured\n", remoteName)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(validateCmd)
-}
\ No newline at end of file
+}
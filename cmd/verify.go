@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"deeployer/internal/config"
+	"deeployer/internal/ignore"
+	"deeployer/internal/manifest"
+	"deeployer/internal/rsync"
+	"deeployer/internal/ssh"
+	"deeployer/pkg/api"
+
+	"github.com/spf13/cobra"
+)
+
+// exitDrift is the exit status of verify when the remote has drifted.
+const exitDrift = 2
+
+const (
+	againstManifest = "manifest"
+	againstLocal    = "local"
+)
+
+// revisionFile is written to the remote path by a deploy of a --ref.
+const revisionFile = "REVISION"
+
+var verifyAgainst string
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [project] [remote]",
+	Short: "Check that a remote still runs the files that were deployed",
+	Long: `Compare the files on a remote with what was deployed, reporting the files added,
+modified or deleted there since, such as by a hot fix made on the server.
+
+By default the remote's files are checksummed over SSH and compared with the
+release manifest written by the last deploy. With --against local, they are
+compared with the current output directory using rsync --checksum --dry-run.
+Preserved and excluded paths are ignored, as are the REVISION file and the
+maintenance flag file.
+
+Exits with status 2 when the remote has drifted.`,
+	Args: cobra.RangeArgs(0, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if verifyAgainst != againstManifest && verifyAgainst != againstLocal {
+			return fmt.Errorf("invalid --against %q: expected %s or %s", verifyAgainst, againstManifest, againstLocal)
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		projectName, project, err := selectProject(cfg, args)
+		if err != nil {
+			return err
+		}
+
+		remoteName, err := selectRemote(project, args)
+		if err != nil {
+			return err
+		}
+
+		remote, err := resolveRemote(cfg, projectName, project, remoteName)
+		if err != nil {
+			return err
+		}
+
+		sshClient := ssh.New(false, verbose)
+		sshClient.Output = newSink()
+		defer sshClient.Close()
+
+		var changes []manifest.Change
+		if verifyAgainst == againstLocal {
+			changes, err = verifyLocal(sshClient, project, remoteName, remote)
+		} else {
+			changes, err = verifyManifest(sshClient, project, remote)
+		}
+		if err != nil {
+			return err
+		}
+
+		if outputFormat != outputText {
+			result := api.VerifyResult{
+				Project: projectName,
+				Remote:  remoteName,
+				Against: verifyAgainst,
+				Drifted: len(changes) > 0,
+				Changes: make([]api.FileChange, 0, len(changes)),
+			}
+			for _, change := range changes {
+				result.Changes = append(result.Changes, api.FileChange{Kind: string(change.Kind), Path: change.Path})
+			}
+			if err := writeResult(result); err != nil {
+				return err
+			}
+		} else {
+			printDrift(remoteName, changes)
+		}
+
+		if len(changes) > 0 {
+			cmd.SilenceUsage = true
+			return &exitError{
+				code: exitDrift,
+				err:  fmt.Errorf("%s has drifted: %d file(s) differ", remoteName, len(changes)),
+			}
+		}
+
+		return nil
+	},
+}
+
+// verifyManifest checksums the files on the remote and compares them with
+// the manifest of the last deploy.
+func verifyManifest(sshClient *ssh.Client, project config.Project, remote config.Remote) ([]manifest.Change, error) {
+	m, err := readManifest(sshClient, remote)
+	if err != nil {
+		return nil, err
+	}
+	if m.Files == nil {
+		return nil, fmt.Errorf("the manifest on %s lists no files; deploy again to record them", remote.Host)
+	}
+
+	skipped := untrackedPaths(remote)
+	out, err := sshClient.Capture(sshTarget(remote), "cd "+ssh.Quote(remote.Path)+" && "+manifest.ChecksumCommand(skipped...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum files on %s: %w", remote.Host, err)
+	}
+
+	actual, err := manifest.ParseChecksums(string(out))
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := resolveSyncs(project, remote)
+	if err != nil {
+		return nil, err
+	}
+	preserved := preserveRules(remote)
+
+	// Files that a sync leaves alone are not drift
+	for relPath := range actual {
+		if excludedPath(preserved, relPath) || !syncedPath(targets, relPath) || slices.Contains(skipped, relPath) {
+			delete(actual, relPath)
+		}
+	}
+
+	return manifest.Compare(m.Files, actual), nil
+}
+
+// verifyLocal compares the remote with the current output directory, by
+// content, as a sync with --delete would see it.
+func verifyLocal(sshClient *ssh.Client, project config.Project, remoteName string, remote config.Remote) ([]manifest.Change, error) {
+	rsyncClient := rsync.New(false, verbose)
+	rsyncClient.Output = newSink()
+	if err := rsyncClient.CheckRsyncAvailable(); err != nil {
+		return nil, fmt.Errorf("rsync check failed: %w", err)
+	}
+
+	targets, err := resolveSyncs(project, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without --delete, rsync would not mention files only on the remote
+	for i, t := range targets {
+		if !config.UsesDelete(t.Options) {
+			targets[i].Options = append(slices.Clone(t.Options), "--delete")
+		}
+	}
+
+	synced, err := targetChanges(rsyncClient, sshClient, remoteName, remote, targets, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// What a sync would create is missing on the remote, and what it would
+	// delete was added there
+	skipped := untrackedPaths(remote)
+	changes := make([]manifest.Change, 0, len(synced))
+	for _, change := range synced {
+		if slices.Contains(skipped, change.Path) {
+			continue
+		}
+		kind := manifest.Modified
+		switch change.Kind {
+		case rsync.ChangeNew:
+			kind = manifest.Deleted
+		case rsync.ChangeDeleted:
+			kind = manifest.Added
+		}
+		changes = append(changes, manifest.Change{Kind: kind, Path: change.Path})
+	}
+
+	return changes, nil
+}
+
+// untrackedPaths returns the files, relative to the remote path, that
+// deeployer writes there itself and that no manifest lists: the REVISION of
+// a ref deploy and the maintenance flag file.
+func untrackedPaths(remote config.Remote) []string {
+	paths := []string{revisionFile}
+	if flagFile := relativeFlagFile(remote); flagFile != "" {
+		paths = append(paths, flagFile)
+	}
+	return paths
+}
+
+// preserveRules returns the remote's preserved paths as rules.
+func preserveRules(remote config.Remote) *ignore.Rules {
+	rules := &ignore.Rules{}
+	for _, p := range remote.Preserve {
+		rules.Add("/" + strings.TrimPrefix(p, "/"))
+	}
+	return rules
+}
+
+// syncedPath reports whether the file at relPath, relative to the remote
+// path, is synced by the innermost target containing it and not excluded
+// by that target's rules.
+func syncedPath(targets []syncTarget, relPath string) bool {
+	var owner *syncTarget
+	var rest string
+	for i, t := range targets {
+		r, ok := t.contains(relPath)
+		if ok && (owner == nil || len(t.Prefix) > len(owner.Prefix)) {
+			owner, rest = &targets[i], r
+		}
+	}
+
+	if owner == nil {
+		return false
+	}
+	return !owner.Dir || !excludedPath(owner.Rules, rest)
+}
+
+// excludedPath reports whether rules exclude the file at relPath or any of
+// the directories containing it.
+func excludedPath(rules *ignore.Rules, relPath string) bool {
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		if rules.Excluded(dir, true) {
+			return true
+		}
+	}
+	return rules.Excluded(relPath, false)
+}
+
+func printDrift(remoteName string, changes []manifest.Change) {
+	if len(changes) == 0 {
+		fmt.Fprintf(humanOutput, "%s matches the deployed files\n", remoteName)
+		return
+	}
+
+	markers := map[manifest.ChangeKind]string{manifest.Added: "+", manifest.Modified: "~", manifest.Deleted: "-"}
+	counts := make(map[manifest.ChangeKind]int)
+
+	fmt.Fprintf(humanOutput, "%s has drifted from the deployed files:\n", remoteName)
+	for _, change := range changes {
+		counts[change.Kind]++
+		fmt.Fprintf(humanOutput, "  %s %s\n", markers[change.Kind], change.Path)
+	}
+	fmt.Fprintf(humanOutput, "\n%d added, %d modified, %d deleted\n", counts[manifest.Added], counts[manifest.Modified], counts[manifest.Deleted])
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringVar(&verifyAgainst, "against", againstManifest, "Compare with the deployed manifest or the local output directory: manifest, local")
+	verifyCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+}
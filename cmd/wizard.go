@@ -0,0 +1,266 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"deeployer/internal/config"
+	"deeployer/internal/git"
+	"deeployer/internal/rsync"
+	"deeployer/internal/ssh"
+
+	"github.com/charmbracelet/huh"
+	"golang.org/x/term"
+)
+
+// wizardSkippable are the phases the wizard offers to skip. Skipping the
+// build is a separate question.
+var wizardSkippable = []string{"sync", "remote_post", "health_check", "local_post"}
+
+// runWizard asks for whatever the arguments leave open: the project, the
+// remotes and the deploy options. It then shows a summary with the commit
+// and the pending changes on each remote, and asks for confirmation. No
+// remotes are returned when the user cancels, and protected reports whether
+// the user already confirmed the protected remotes by typing their names.
+func runWizard(cfg *config.Config, args []string) (projectName string, project config.Project, remoteNames []string, protected bool, err error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", config.Project{}, nil, false, fmt.Errorf("project and remote not given; pass them as arguments when not running in a terminal")
+	}
+
+	var query string
+	if len(args) > 0 {
+		projectName = args[0]
+		if _, exists := cfg.Projects[projectName]; !exists {
+			return "", config.Project{}, nil, false, fmt.Errorf("project '%s' not found in configuration", projectName)
+		}
+	}
+
+	rebuild := !noBuild
+	skip := slices.Clone(skipPhases)
+
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Project").
+				Description("Type to search, enter to pick from the matches").
+				Value(&query),
+			huh.NewSelect[string]().
+				OptionsFunc(func() []huh.Option[string] {
+					return huh.NewOptions(fuzzyFilter(sortedNames(cfg.Projects), query)...)
+				}, &query).
+				Height(8).
+				Validate(func(name string) error {
+					if name == "" {
+						return errors.New("no project matches")
+					}
+					return nil
+				}).
+				Value(&projectName),
+		).WithHideFunc(func() bool { return len(args) > 0 }),
+		huh.NewGroup(
+			huh.NewMultiSelect[string]().
+				Title("Remotes").
+				Description("space to select, enter to continue").
+				OptionsFunc(func() []huh.Option[string] {
+					return huh.NewOptions(cfg.Projects[projectName].Remotes...)
+				}, &projectName).
+				Validate(func(names []string) error {
+					if len(names) == 0 {
+						return errors.New("select at least one remote")
+					}
+					return nil
+				}).
+				Value(&remoteNames),
+		),
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("Dry run?").
+				Description("Only show the plan, without building or changing anything").
+				Value(&dryRun),
+			huh.NewConfirm().
+				Title("Run the build commands?").
+				Description("Choose no to deploy the existing output directory").
+				Value(&rebuild),
+			huh.NewMultiSelect[string]().
+				Title("Skip phases").
+				Options(huh.NewOptions(wizardSkippable...)...).
+				Value(&skip),
+		),
+	)
+
+	if err := form.Run(); err != nil {
+		return "", config.Project{}, nil, false, fmt.Errorf("deploy wizard failed: %w", err)
+	}
+
+	noBuild = !rebuild
+	skipPhases = skip
+	project = cfg.Projects[projectName]
+
+	summary := wizardSummary(cfg, projectName, project, remoteNames)
+
+	confirmTitle := "Deploy?"
+	if dryRun {
+		confirmTitle = "Show the plan?"
+	}
+
+	var confirmed bool
+	confirm := huh.NewForm(
+		huh.NewGroup(
+			huh.NewNote().Title("Summary").Description(summary),
+			huh.NewConfirm().Title(confirmTitle).Value(&confirmed),
+		),
+	)
+
+	if err := confirm.Run(); err != nil {
+		return "", config.Project{}, nil, false, fmt.Errorf("deploy wizard failed: %w", err)
+	}
+
+	if !confirmed {
+		fmt.Fprintln(humanOutput, "Deploy cancelled")
+		return projectName, project, nil, false, nil
+	}
+
+	// A dry run changes nothing, so protected remotes need no typing
+	if !dryRun {
+		if err := confirmProtected(cfg, project, remoteNames); err != nil {
+			return "", config.Project{}, nil, false, err
+		}
+		// Typing the names is the confirmation, so don't ask again
+		protected = true
+	}
+
+	return projectName, project, remoteNames, protected, nil
+}
+
+// confirmProtected makes the user type the name of every protected remote
+// among remoteNames, as the project sees them.
+func confirmProtected(cfg *config.Config, project config.Project, remoteNames []string) error {
+	var fields []huh.Field
+	typed := make([]string, len(remoteNames))
+	for i, name := range remoteNames {
+		remote, _ := cfg.Remote(project, name)
+		if !remote.Protected {
+			continue
+		}
+		fields = append(fields, huh.NewInput().
+			Title(fmt.Sprintf("%s is protected. Type its name to deploy", name)).
+			Description(remote.ConfirmMessage).
+			Validate(func(s string) error {
+				if s != name {
+					return fmt.Errorf("type %q to confirm", name)
+				}
+				return nil
+			}).
+			Value(&typed[i]))
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if err := huh.NewForm(huh.NewGroup(fields...)).Run(); err != nil {
+		return fmt.Errorf("deploy to protected remote not confirmed: %w", err)
+	}
+
+	return nil
+}
+
+// wizardSummary describes the chosen deploy, including the commit being
+// deployed, --ref or else HEAD, and what syncing the current output would
+// change on each remote.
+func wizardSummary(cfg *config.Config, projectName string, project config.Project, remoteNames []string) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Project:  %s (%s)\n", projectName, project.Path)
+
+	// With --ref the working tree is not what gets deployed
+	var commit string
+	if gitRef != "" {
+		if resolved, err := git.Resolve(project.Path, gitRef); err != nil {
+			commit = "unknown: " + err.Error()
+		} else {
+			commit = resolved.Short + " " + resolved.Subject + " (" + gitRef + ")"
+		}
+	} else if head, err := git.Head(project.Path); err != nil {
+		commit = "unknown: " + err.Error()
+	} else {
+		commit = head.Short + " " + head.Subject
+		if dirty, err := git.Dirty(project.Path); err == nil && dirty {
+			commit += " (uncommitted changes)"
+		}
+	}
+	fmt.Fprintf(&b, "Commit:   %s\n", commit)
+
+	fmt.Fprintf(&b, "Remotes:  %s\n", strings.Join(remoteNames, ", "))
+
+	options := []string{fmt.Sprintf("dry run: %s", yesNo(dryRun)), fmt.Sprintf("build: %s", yesNo(!noBuild))}
+	if len(skipPhases) > 0 {
+		options = append(options, "skip: "+strings.Join(skipPhases, ", "))
+	}
+	fmt.Fprintf(&b, "Options:  %s\n", strings.Join(options, ", "))
+
+	b.WriteString("\nChanges in the current output directory")
+	if !noBuild {
+		b.WriteString(", before building")
+	}
+	b.WriteString(":\n")
+
+	rsyncClient := rsync.New(false, false)
+	rsyncClient.Output = newSink()
+	if err := rsyncClient.CheckRsyncAvailable(); err != nil {
+		fmt.Fprintf(&b, "  unavailable: %v\n", err)
+		return b.String()
+	}
+	sshClient := ssh.New(false, false)
+	sshClient.Output = newSink()
+
+	for _, remoteName := range remoteNames {
+		fmt.Fprintf(humanOutput, "Comparing with %s...\n", remoteName)
+
+		remote, err := resolveRemote(cfg, projectName, project, remoteName)
+		if err == nil {
+			var changes []rsync.Change
+			changes, err = remoteChanges(rsyncClient, sshClient, project, remoteName, remote, false)
+			if err == nil {
+				fmt.Fprintf(&b, "  %s: %s\n", remoteName, summarizeChanges(changes))
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "  %s: unavailable: %v\n", remoteName, err)
+	}
+
+	return b.String()
+}
+
+// fuzzyFilter returns the names containing the letters of query in order,
+// ignoring case, such as "wapp" for "webapp".
+func fuzzyFilter(names []string, query string) []string {
+	letters := []rune(strings.ToLower(strings.TrimSpace(query)))
+	if len(letters) == 0 {
+		return names
+	}
+
+	var matches []string
+	for _, name := range names {
+		rest := letters
+		for _, r := range strings.ToLower(name) {
+			if len(rest) > 0 && r == rest[0] {
+				rest = rest[1:]
+			}
+		}
+		if len(rest) == 0 {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -1,9 +1,15 @@
 package config
 
 import (
+	"cmp"
 	"fmt"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
@@ -18,18 +24,438 @@ type Project struct {
 	BuildCommands []string `toml:"build_commands"`
 	OutputDir     string   `toml:"output_dir"`
 	PostCommands  []string `toml:"post_commands"`
-	Remotes       []string `toml:"remotes"`
+
+	// BuildImage, when set, runs the build commands in a container of
+	// this image with BuildRuntime, or docker or podman when empty.
+	BuildImage   string `toml:"build_image"`
+	BuildRuntime string `toml:"build_runtime"`
+
+	// Remotes is either a list of names or a table of overrides keyed by
+	// name, so both are decoded by Parse.
+	Remotes   []string                  `toml:"-"`
+	Overrides map[string]RemoteOverride `toml:"-"`
+
+	Exclude     []string `toml:"exclude"`
+	Include     []string `toml:"include"`
+	ExcludeFrom []string `toml:"exclude_from"`
+
+	Git *GitPolicy `toml:"git"`
+
+	Hooks Hooks `toml:"hooks"`
+
+	// Sync, when set, replaces OutputDir with several files and
+	// directories, each synced to its own place on the remote.
+	Sync []SyncMapping `toml:"sync"`
+
+	// Permissions apply to the output directory and every sync entry.
+	Permissions
 }
 
-type Remote struct {
-	Host         string   `toml:"host"`
-	Path         string   `toml:"path"`
-	User         string   `toml:"user"`
+// SyncMapping syncs a local file or directory to a remote.
+type SyncMapping struct {
+	// Source is relative to the project path. A directory's contents are
+	// synced into Dest. A trailing slash marks a directory that the build
+	// has yet to create.
+	Source string `toml:"source"`
+	// Dest is relative to the remote path unless absolute. A file is
+	// synced to Dest, or into it keeping its name when Dest is empty or
+	// ends with a slash.
+	Dest string `toml:"dest"`
+
+	// RsyncOptions replace the remote's options when set.
 	RsyncOptions []string `toml:"rsync_options"`
-	PostCommands []string `toml:"post_commands"`
+
+	// Exclude and Include add to the project's rules.
+	Exclude []string `toml:"exclude"`
+	Include []string `toml:"include"`
+
+	// Permissions default to the project's.
+	Permissions
+}
+
+// Permissions are given to synced files on the remote. Modes are octal,
+// such as "2775".
+type Permissions struct {
+	Owner    string `toml:"owner"`
+	Group    string `toml:"group"`
+	DirMode  string `toml:"dir_mode"`
+	FileMode string `toml:"file_mode"`
+}
+
+// Or returns the permissions with unset fields taken from defaults.
+func (p Permissions) Or(defaults Permissions) Permissions {
+	p.Owner = cmp.Or(p.Owner, defaults.Owner)
+	p.Group = cmp.Or(p.Group, defaults.Group)
+	p.DirMode = cmp.Or(p.DirMode, defaults.DirMode)
+	p.FileMode = cmp.Or(p.FileMode, defaults.FileMode)
+	return p
+}
+
+// Chown returns the owner and group as OWNER:GROUP for chown and rsync
+// --chown, or "" when neither is set.
+func (p Permissions) Chown() string {
+	if p.Group == "" {
+		return p.Owner
+	}
+	return p.Owner + ":" + p.Group
+}
+
+// Chmod returns the modes as rsync --chmod rules, or "" when neither is
+// set.
+func (p Permissions) Chmod() string {
+	var rules []string
+	if p.DirMode != "" {
+		rules = append(rules, "D"+p.DirMode)
+	}
+	if p.FileMode != "" {
+		rules = append(rules, "F"+p.FileMode)
+	}
+	return strings.Join(rules, ",")
+}
+
+func (p Permissions) Validate() error {
+	for _, name := range []string{p.Owner, p.Group} {
+		if name != "" && !ownerName.MatchString(name) {
+			return fmt.Errorf("invalid owner or group %q", name)
+		}
+	}
+	for _, mode := range []string{p.DirMode, p.FileMode} {
+		if mode != "" && !fileMode.MatchString(mode) {
+			return fmt.Errorf("invalid mode %q: expected octal such as 0755", mode)
+		}
+	}
+	return nil
+}
+
+var (
+	// ownerName matches user and group names and numeric ids.
+	ownerName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*\$?$`)
+	fileMode  = regexp.MustCompile(`^[0-7]{3,4}$`)
+)
+
+// Mappings returns what the project syncs: its sync entries, or else its
+// output directory synced to the remote path.
+func (p Project) Mappings() []SyncMapping {
+	if len(p.Sync) == 0 {
+		return []SyncMapping{{Source: p.OutputDir, Permissions: p.Permissions}}
+	}
+
+	mappings := make([]SyncMapping, 0, len(p.Sync))
+	for _, mapping := range p.Sync {
+		mapping.Permissions = mapping.Permissions.Or(p.Permissions)
+		mappings = append(mappings, mapping)
+	}
+	return mappings
+}
+
+// DestPath returns where on a remote with the given path the mapping syncs
+// to, keeping a trailing slash.
+func (m SyncMapping) DestPath(remotePath string) string {
+	dest := m.Dest
+	if !path.IsAbs(dest) {
+		dest = path.Join(remotePath, dest)
+	}
+	dest = path.Clean(dest)
+	if strings.HasSuffix(m.Dest, "/") && dest != "/" {
+		dest += "/"
+	}
+	return dest
+}
+
+// Options returns the rsync options of the mapping on the remote.
+func (m SyncMapping) Options(remote Remote) []string {
+	if len(m.RsyncOptions) > 0 {
+		return m.RsyncOptions
+	}
+	return remote.RsyncOptions
+}
+
+func (m SyncMapping) Validate() error {
+	if m.Source == "" {
+		return fmt.Errorf("source not specified")
+	}
+	if HasTraversal(m.Source) {
+		return fmt.Errorf("source contains directory traversal: %s", m.Source)
+	}
+	if filepath.IsAbs(m.Source) {
+		return fmt.Errorf("source must be relative to the project path: %s", m.Source)
+	}
+	if HasTraversal(m.Dest) {
+		return fmt.Errorf("dest contains directory traversal: %s", m.Dest)
+	}
+	return m.Permissions.Validate()
+}
+
+// HasTraversal reports whether p has a ".." element.
+func HasTraversal(p string) bool {
+	return slices.Contains(strings.Split(filepath.ToSlash(p), "/"), "..")
+}
+
+// RemoteOverride changes a shared remote's settings for one project. The
+// plain fields replace the remote's and the extra ones add to them.
+type RemoteOverride struct {
+	Path              string            `toml:"path"`
+	RsyncOptions      []string          `toml:"rsync_options"`
+	ExtraRsyncOptions []string          `toml:"extra_rsync_options"`
+	PostCommands      []RemoteCommand   `toml:"post_commands"`
+	ExtraPostCommands []RemoteCommand   `toml:"extra_post_commands"`
+	Env               map[string]string `toml:"env"`
+}
+
+// Apply returns the remote with the override's settings.
+func (o RemoteOverride) Apply(remote Remote) Remote {
+	if o.Path != "" {
+		remote.Path = o.Path
+	}
+	if len(o.RsyncOptions) > 0 {
+		remote.RsyncOptions = o.RsyncOptions
+	}
+	if len(o.ExtraRsyncOptions) > 0 {
+		remote.RsyncOptions = append(slices.Clone(remote.RsyncOptions), o.ExtraRsyncOptions...)
+	}
+	if len(o.PostCommands) > 0 {
+		remote.PostCommands = o.PostCommands
+	}
+	if len(o.ExtraPostCommands) > 0 {
+		remote.PostCommands = append(slices.Clone(remote.PostCommands), o.ExtraPostCommands...)
+	}
+	if len(o.Env) > 0 {
+		env := maps.Clone(remote.Env)
+		if env == nil {
+			env = make(map[string]string, len(o.Env))
+		}
+		maps.Copy(env, o.Env)
+		remote.Env = env
+	}
+	return remote
+}
+
+// Overridden reports whether the override changes anything.
+func (o RemoteOverride) Overridden() bool {
+	return o.Path != "" || len(o.RsyncOptions) > 0 || len(o.ExtraRsyncOptions) > 0 ||
+		len(o.PostCommands) > 0 || len(o.ExtraPostCommands) > 0 || len(o.Env) > 0
+}
+
+// Remote returns the named remote as the project sees it, with its
+// overrides applied.
+func (c *Config) Remote(project Project, name string) (Remote, bool) {
+	remote, exists := c.Remotes[name]
+	if !exists {
+		return Remote{}, false
+	}
+	return project.Overrides[name].Apply(remote), true
+}
+
+// Hooks are commands run around the phases of a deploy. A project's hooks
+// run locally in the project directory and a remote's hooks run on the
+// remote.
+type Hooks struct {
+	PreBuild  []string `toml:"pre_build"`
+	PostBuild []string `toml:"post_build"`
+	PreSync   []string `toml:"pre_sync"`
+	PostSync  []string `toml:"post_sync"`
+	OnSuccess []string `toml:"on_success"`
+	OnFailure []string `toml:"on_failure"`
+	Always    []string `toml:"always"`
+}
+
+// HookNames lists the hooks in the order they run.
+var HookNames = []string{"pre_build", "post_build", "pre_sync", "post_sync", "on_success", "on_failure", "always"}
+
+// Commands returns the commands of the named hook.
+func (h Hooks) Commands(name string) []string {
+	switch name {
+	case "pre_build":
+		return h.PreBuild
+	case "post_build":
+		return h.PostBuild
+	case "pre_sync":
+		return h.PreSync
+	case "post_sync":
+		return h.PostSync
+	case "on_success":
+		return h.OnSuccess
+	case "on_failure":
+		return h.OnFailure
+	case "always":
+		return h.Always
+	}
+	return nil
+}
+
+// GitPolicy lists what the project's repository must satisfy before it is
+// deployed. Every check is off by default.
+type GitPolicy struct {
+	RequireClean  bool   `toml:"require_clean"`
+	RequireBranch string `toml:"require_branch"`
+	RequirePushed bool   `toml:"require_pushed"`
+	RequireSigned bool   `toml:"require_signed"`
+	RequireTag    bool   `toml:"require_tag"`
+}
+
+type Remote struct {
+	Host         string          `toml:"host"`
+	Path         string          `toml:"path"`
+	User         string          `toml:"user"`
+	RsyncOptions []string        `toml:"rsync_options"`
+	PostCommands []RemoteCommand `toml:"post_commands"`
+	// HealthChecks run on the remote after the post commands. Each one
+	// must exit with status 0 for the deploy to succeed.
+	HealthChecks []string `toml:"health_checks"`
+
+	HostKeyFingerprints []string `toml:"host_key_fingerprints"`
+
+	Auth            []string `toml:"auth"`
+	IdentityFile    string   `toml:"identity_file"`
+	CertificateFile string   `toml:"certificate_file"`
+
+	PTY             bool   `toml:"pty"`
+	SudoPasswordEnv string `toml:"sudo_password_env"`
+
+	// Env is exported to the remote's commands during deploys.
+	Env map[string]string `toml:"env"`
+
+	Preserve []string `toml:"preserve"`
+
+	// Protected remotes need confirmation, or --yes, before every deploy.
+	// ConfirmMessage is shown when asking.
+	Protected      bool   `toml:"protected"`
+	ConfirmMessage string `toml:"confirm_message"`
+
+	// DeployWindow, when set, rejects deploys outside the allowed times.
+	DeployWindow *DeployWindow `toml:"deploy_window"`
+
+	Hooks Hooks `toml:"hooks"`
+
+	Maintenance *Maintenance `toml:"maintenance"`
+}
+
+// RemoteCommand is one of a remote's post commands, written as a string or
+// as a table with command and pty.
+type RemoteCommand struct {
+	Command string `toml:"command"`
+	// PTY runs this command on a remote terminal, as the remote's pty does
+	// for all of them.
+	PTY bool `toml:"pty"`
+}
+
+func (c *RemoteCommand) UnmarshalTOML(data any) error {
+	switch v := data.(type) {
+	case string:
+		c.Command = v
+		return nil
+	case map[string]any:
+		for key, value := range v {
+			var ok bool
+			switch key {
+			case "command":
+				c.Command, ok = value.(string)
+			case "pty":
+				c.PTY, ok = value.(bool)
+			default:
+				return fmt.Errorf("unknown post command key %q: expected command or pty", key)
+			}
+			if !ok {
+				return fmt.Errorf("invalid post command %s: %v", key, value)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid post command %v: expected a string or a table with command and pty", data)
+}
+
+// Commands returns the commands alone.
+func Commands(commands []RemoteCommand) []string {
+	lines := make([]string, 0, len(commands))
+	for _, c := range commands {
+		lines = append(lines, c.Command)
+	}
+	return lines
+}
+
+// EnvList returns the remote's environment as sorted KEY=value pairs.
+func (r *Remote) EnvList() []string {
+	env := make([]string, 0, len(r.Env))
+	for _, name := range sortedKeys(r.Env) {
+		env = append(env, name+"="+r.Env[name])
+	}
+	return env
+}
+
+// Maintenance puts a remote into maintenance mode while it is deployed to,
+// either by creating a flag file that the web server checks or by running
+// commands.
+type Maintenance struct {
+	// FlagFile is relative to the remote path unless absolute.
+	FlagFile string   `toml:"flag_file"`
+	Enable   []string `toml:"enable"`
+	Disable  []string `toml:"disable"`
+}
+
+func (m *Maintenance) Validate() error {
+	commands := len(m.Enable) > 0 || len(m.Disable) > 0
+	switch {
+	case m.FlagFile != "" && commands:
+		return fmt.Errorf("set either flag_file or enable and disable, not both")
+	case m.FlagFile != "":
+		if HasTraversal(m.FlagFile) {
+			return fmt.Errorf("invalid flag_file %q", m.FlagFile)
+		}
+	case len(m.Enable) == 0 || len(m.Disable) == 0:
+		return fmt.Errorf("set flag_file, or both enable and disable")
+	}
+	return nil
+}
+
+// envName matches the names of environment variables a shell can export.
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sharedRoots are remote paths that usually hold more than one site or
+// user's data, where an unprotected --delete is almost always a mistake.
+var sharedRoots = []string{"/", "/home", "/opt", "/srv", "/srv/www", "/tmp", "/usr/share/nginx/html", "/var", "/var/www", "/var/www/html"}
+
+// authMethods lists the values accepted in Remote.Auth.
+var authMethods = []string{"agent", "publickey", "password", "keyboard-interactive"}
+
+// Severity tells whether an Issue makes the configuration unusable.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a problem found in the configuration. Path locates it, such as
+// "projects.webapp" or "remotes.production".
+type Issue struct {
+	Path     string
+	Message  string
+	Severity Severity
+}
+
+func (i Issue) Error() string {
+	if i.Path == "" {
+		return i.Message
+	}
+	return i.Path + ": " + i.Message
 }
 
 func Load() (*Config, error) {
+	config, err := Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
+
+	return config, nil
+}
+
+// Parse reads the configuration file and fills in defaults without
+// validating it.
+func Parse() (*Config, error) {
 	configPath, err := getConfigPath()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get config path: %w", err)
@@ -39,42 +465,155 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("config file not found at %s", configPath)
 	}
 
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	return parse(string(data))
+}
+
+// parse decodes a configuration and fills in defaults.
+func parse(data string) (*Config, error) {
 	var config Config
-	if _, err := toml.DecodeFile(configPath, &config); err != nil {
+	if _, err := toml.Decode(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if err := decodeProjectRemotes(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
+	for name, remote := range config.Remotes {
+		if len(remote.RsyncOptions) == 0 {
+			remote.RsyncOptions = []string{"-avz"}
+		}
+		config.Remotes[name] = remote
 	}
 
 	return &config, nil
 }
 
+// decodeProjectRemotes reads each project's remotes, given either as a
+// list of names or as a table of overrides keyed by name, in file order.
+func decodeProjectRemotes(data string, config *Config) error {
+	var raw struct {
+		Projects map[string]struct {
+			Remotes toml.Primitive `toml:"remotes"`
+		} `toml:"projects"`
+	}
+	md, err := toml.Decode(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	for name, project := range config.Projects {
+		remotes := raw.Projects[name].Remotes
+		// Tables are only typed when they have a header of their own
+		if md.Type("projects", name, "remotes") == "Array" {
+			err = md.PrimitiveDecode(remotes, &project.Remotes)
+		} else if md.IsDefined("projects", name, "remotes") {
+			err = md.PrimitiveDecode(remotes, &project.Overrides)
+			for _, key := range md.Keys() {
+				if len(key) > 3 && key[0] == "projects" && key[1] == name && key[2] == "remotes" && !slices.Contains(project.Remotes, key[3]) {
+					project.Remotes = append(project.Remotes, key[3])
+				}
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("projects.%s.remotes: %w", name, err)
+		}
+		config.Projects[name] = project
+	}
+
+	return nil
+}
+
+// Validate returns the first error found by Check.
 func (c *Config) Validate() error {
+	for _, issue := range c.Check() {
+		if issue.Severity == SeverityError {
+			return issue
+		}
+	}
+
+	return nil
+}
+
+// Check validates every project and remote and returns all errors and
+// warnings, ordered by path.
+func (c *Config) Check() []Issue {
+	var issues []Issue
+
 	if len(c.Projects) == 0 {
-		return fmt.Errorf("no projects defined")
+		issues = append(issues, Issue{Path: "projects", Message: "no projects defined", Severity: SeverityError})
 	}
 
-	for name, project := range c.Projects {
+	used := make(map[string]bool)
+	for _, name := range sortedKeys(c.Projects) {
+		project := c.Projects[name]
+		prefix := "projects." + name
+
 		if err := project.Validate(); err != nil {
-			return fmt.Errorf("project %s: %w", name, err)
+			issues = append(issues, Issue{Path: prefix, Message: err.Error(), Severity: SeverityError})
 		}
 
 		for _, remoteName := range project.Remotes {
-			if _, exists := c.Remotes[remoteName]; !exists {
-				return fmt.Errorf("project %s references unknown remote: %s", name, remoteName)
+			used[remoteName] = true
+			remote, exists := c.Remote(project, remoteName)
+			if !exists {
+				issues = append(issues, Issue{Path: prefix + ".remotes", Message: "unknown remote: " + remoteName, Severity: SeverityError})
+				continue
+			}
+
+			if project.Overrides[remoteName].Overridden() {
+				if err := remote.Validate(); err != nil {
+					issues = append(issues, Issue{Path: prefix + ".remotes." + remoteName, Message: err.Error(), Severity: SeverityError})
+				}
+			}
+
+			for i, mapping := range project.Sync {
+				if err := remote.CheckDest(mapping.DestPath(remote.Path), mapping.Options(remote)); err != nil {
+					issues = append(issues, Issue{Path: fmt.Sprintf("%s.sync.%d", prefix, i+1),
+						Message: fmt.Sprintf("on %s: %v", remoteName, err), Severity: SeverityError})
+				}
 			}
 		}
 	}
 
-	for name, remote := range c.Remotes {
+	for _, name := range sortedKeys(c.Remotes) {
+		remote := c.Remotes[name]
+		prefix := "remotes." + name
+
 		if err := remote.Validate(); err != nil {
-			return fmt.Errorf("remote %s: %w", name, err)
+			issues = append(issues, Issue{Path: prefix, Message: err.Error(), Severity: SeverityError})
+			continue
+		}
+
+		if !used[name] {
+			issues = append(issues, Issue{Path: prefix, Message: "not used by any project", Severity: SeverityWarning})
+		}
+
+		if remote.ConfirmMessage != "" && !remote.Protected {
+			issues = append(issues, Issue{Path: prefix + ".confirm_message",
+				Message: "only shown for protected remotes; set protected = true", Severity: SeverityWarning})
+		}
+
+		if remote.UsesDelete() && len(remote.Preserve) == 0 {
+			issues = append(issues, Issue{Path: prefix + ".rsync_options",
+				Message: "--delete removes every remote file missing from the output directory and no paths are preserved", Severity: SeverityWarning})
 		}
 	}
 
-	return nil
+	return issues
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
 }
 
 func (p *Project) Validate() error {
@@ -98,14 +637,37 @@ func (p *Project) Validate() error {
 		return fmt.Errorf("no build commands defined")
 	}
 
-	if p.OutputDir == "" {
+	if p.BuildRuntime != "" && p.BuildImage == "" {
+		return fmt.Errorf("build_runtime is set without a build_image")
+	}
+
+	if p.OutputDir == "" && len(p.Sync) == 0 {
 		return fmt.Errorf("output directory not specified")
 	}
 
+	if err := p.Permissions.Validate(); err != nil {
+		return err
+	}
+
+	for i, mapping := range p.Sync {
+		if err := mapping.Validate(); err != nil {
+			return fmt.Errorf("invalid sync entry %d: %w", i+1, err)
+		}
+	}
+
 	if len(p.Remotes) == 0 {
 		return fmt.Errorf("no remotes specified")
 	}
 
+	for _, file := range p.ExcludeFrom {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(absPath, file)
+		}
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("cannot read exclude_from file: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -122,13 +684,97 @@ func (r *Remote) Validate() error {
 		return fmt.Errorf("user not specified")
 	}
 
-	if len(r.RsyncOptions) == 0 {
-		r.RsyncOptions = []string{"-avz"}
+	for _, fingerprint := range r.HostKeyFingerprints {
+		if !strings.HasPrefix(fingerprint, "SHA256:") {
+			return fmt.Errorf("invalid host key fingerprint %q: expected SHA256:<base64>", fingerprint)
+		}
+	}
+
+	for name := range r.Env {
+		if !envName.MatchString(name) {
+			return fmt.Errorf("invalid env name %q", name)
+		}
+	}
+
+	for _, p := range r.Preserve {
+		if p == "" || HasTraversal(p) {
+			return fmt.Errorf("invalid preserve path %q", p)
+		}
+	}
+
+	for _, c := range r.PostCommands {
+		if strings.TrimSpace(c.Command) == "" {
+			return fmt.Errorf("post command not specified")
+		}
+	}
+
+	for _, check := range r.HealthChecks {
+		if strings.TrimSpace(check) == "" {
+			return fmt.Errorf("health check not specified")
+		}
+	}
+
+	if err := r.CheckDest(r.Path, r.RsyncOptions); err != nil {
+		return err
+	}
+
+	for _, method := range r.Auth {
+		if !slices.Contains(authMethods, method) {
+			return fmt.Errorf("unknown auth method %q: expected one of %s", method, strings.Join(authMethods, ", "))
+		}
+	}
+
+	if r.DeployWindow != nil {
+		if err := r.DeployWindow.Validate(); err != nil {
+			return fmt.Errorf("invalid deploy_window: %w", err)
+		}
+	}
+
+	if r.Maintenance != nil {
+		if err := r.Maintenance.Validate(); err != nil {
+			return fmt.Errorf("invalid maintenance: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// CheckDest refuses syncing to dest with options that would delete files
+// on a shared path the remote does not preserve anything in.
+func (r *Remote) CheckDest(dest string, options []string) error {
+	if UsesDelete(options) && len(r.Preserve) == 0 && isSharedRoot(dest) {
+		return fmt.Errorf("rsync_options use --delete on shared path %s without any preserve entries; "+
+			"sync to a dedicated directory or list the paths to keep in preserve", dest)
+	}
+	return nil
+}
+
+// UsesDelete reports whether the remote's own rsync options delete files.
+func (r *Remote) UsesDelete() bool {
+	return UsesDelete(r.RsyncOptions)
+}
+
+// UsesDelete reports whether the rsync options remove files on the remote
+// that do not exist locally.
+func UsesDelete(options []string) bool {
+	for _, option := range options {
+		if strings.HasPrefix(option, "--delete") || option == "--del" {
+			return true
+		}
+	}
+	return false
+}
+
+func isSharedRoot(remotePath string) bool {
+	cleaned := path.Clean(remotePath)
+	if slices.Contains(sharedRoots, cleaned) {
+		return true
+	}
+
+	// A user's home directory, such as /home/deploy
+	return path.Dir(cleaned) == "/home"
+}
+
 func getConfigPath() (string, error) {
 	xdgConfig := os.Getenv("XDG_CONFIG_HOME")
 	if xdgConfig == "" {
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestPostCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		toml    string
+		want    []RemoteCommand
+		wantErr bool
+	}{
+		{
+			name: "strings",
+			toml: `post_commands = ["a", "b"]`,
+			want: []RemoteCommand{{Command: "a"}, {Command: "b"}},
+		},
+		{
+			name: "tables",
+			toml: `post_commands = [{ command = "sudo systemctl restart nginx", pty = true }, { command = "b" }]`,
+			want: []RemoteCommand{{Command: "sudo systemctl restart nginx", PTY: true}, {Command: "b"}},
+		},
+		{
+			name: "mixed",
+			toml: `post_commands = ["a", { command = "sudo true", pty = true }]`,
+			want: []RemoteCommand{{Command: "a"}, {Command: "sudo true", PTY: true}},
+		},
+		{
+			name: "array of tables",
+			toml: "[[remotes.web.post_commands]]\ncommand = \"sudo true\"\npty = true",
+			want: []RemoteCommand{{Command: "sudo true", PTY: true}},
+		},
+		{
+			name:    "unknown key",
+			toml:    `post_commands = [{ cmd = "a" }]`,
+			wantErr: true,
+		},
+		{
+			name:    "pty not a boolean",
+			toml:    `post_commands = [{ command = "a", pty = "yes" }]`,
+			wantErr: true,
+		},
+		{
+			name:    "not a string or table",
+			toml:    `post_commands = [1]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parse("[remotes.web]\nhost = \"example.com\"\nuser = \"deploy\"\npath = \"/srv/web\"\n" + tt.toml + "\n")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parse succeeded with %s", tt.toml)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := cfg.Remotes["web"].PostCommands; !slices.Equal(got, tt.want) {
+				t.Errorf("post commands\ngot  %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostCommandsValidate(t *testing.T) {
+	remote := Remote{Host: "example.com", User: "deploy", Path: "/srv/web", PostCommands: []RemoteCommand{{PTY: true}}}
+	if err := remote.Validate(); err == nil {
+		t.Error("a post command without a command was accepted")
+	}
+}
+
+func TestHasTraversal(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"dist", false},
+		{"assets/app..min.js", false},
+		{"..hidden", false},
+		{"..", true},
+		{"../secrets", true},
+		{"dist/../../secrets", true},
+		{"dist/..", true},
+	}
+
+	for _, tt := range tests {
+		if got := HasTraversal(tt.path); got != tt.want {
+			t.Errorf("HasTraversal(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+const remotesConfig = `
+[remotes.web]
+host = "web.example.com"
+user = "deploy"
+path = "/srv/web"
+rsync_options = ["-avz"]
+post_commands = ["systemctl reload nginx"]
+env = { APP_ENV = "production", LOG_LEVEL = "warn" }
+
+[remotes.staging]
+host = "staging.example.com"
+user = "deploy"
+path = "/srv/staging"
+
+[projects.site]
+path = "/src/site"
+build_commands = ["make"]
+output_dir = "dist"
+`
+
+func TestProjectRemotes(t *testing.T) {
+	tests := []struct {
+		name          string
+		toml          string
+		wantRemotes   []string
+		wantOverrides []string
+	}{
+		{
+			name:        "list",
+			toml:        `remotes = ["staging", "web"]`,
+			wantRemotes: []string{"staging", "web"},
+		},
+		{
+			name:          "inline table",
+			toml:          `remotes = { web = { path = "/srv/site" }, staging = {} }`,
+			wantRemotes:   []string{"web", "staging"},
+			wantOverrides: []string{"web"},
+		},
+		{
+			name:          "table",
+			toml:          "[projects.site.remotes.staging]\n[projects.site.remotes.web]\npath = \"/srv/site\"",
+			wantRemotes:   []string{"staging", "web"},
+			wantOverrides: []string{"web"},
+		},
+		{
+			name:          "dotted keys",
+			toml:          "remotes.web.path = \"/srv/site\"",
+			wantRemotes:   []string{"web"},
+			wantOverrides: []string{"web"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parse(remotesConfig + tt.toml + "\n")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			project := cfg.Projects["site"]
+			if !slices.Equal(project.Remotes, tt.wantRemotes) {
+				t.Errorf("remotes %q, want %q", project.Remotes, tt.wantRemotes)
+			}
+			for _, name := range project.Remotes {
+				if got, want := project.Overrides[name].Overridden(), slices.Contains(tt.wantOverrides, name); got != want {
+					t.Errorf("%s overridden = %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProjectRemotesUnknown(t *testing.T) {
+	for _, remotes := range []string{`remotes = ["web", "db"]`, `remotes = { db = { path = "/srv/db" } }`} {
+		cfg, err := parse(remotesConfig + remotes + "\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := Issue{Path: "projects.site.remotes", Message: "unknown remote: db", Severity: SeverityError}
+		if !slices.Contains(cfg.Check(), want) {
+			t.Errorf("%s: no issue %q in %v", remotes, want, cfg.Check())
+		}
+	}
+}
+
+func TestRemoteOverrideApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		want     func(r *Remote)
+	}{
+		{
+			name: "nothing",
+			want: func(r *Remote) {},
+		},
+		{
+			name:     "path",
+			override: `path = "/srv/site"`,
+			want:     func(r *Remote) { r.Path = "/srv/site" },
+		},
+		{
+			name:     "rsync options",
+			override: `rsync_options = ["-rlt"]`,
+			want:     func(r *Remote) { r.RsyncOptions = []string{"-rlt"} },
+		},
+		{
+			name:     "extra rsync options",
+			override: `extra_rsync_options = ["--delete"]`,
+			want:     func(r *Remote) { r.RsyncOptions = []string{"-avz", "--delete"} },
+		},
+		{
+			name:     "replaced and extra rsync options",
+			override: `rsync_options = ["-rlt"], extra_rsync_options = ["--delete"]`,
+			want:     func(r *Remote) { r.RsyncOptions = []string{"-rlt", "--delete"} },
+		},
+		{
+			name:     "post commands",
+			override: `post_commands = ["true"]`,
+			want:     func(r *Remote) { r.PostCommands = []RemoteCommand{{Command: "true"}} },
+		},
+		{
+			name:     "extra post commands",
+			override: `extra_post_commands = [{ command = "sudo true", pty = true }]`,
+			want: func(r *Remote) {
+				r.PostCommands = []RemoteCommand{{Command: "systemctl reload nginx"}, {Command: "sudo true", PTY: true}}
+			},
+		},
+		{
+			name:     "env",
+			override: `env = { LOG_LEVEL = "debug", SITE = "site" }`,
+			want: func(r *Remote) {
+				r.Env = map[string]string{"APP_ENV": "production", "LOG_LEVEL": "debug", "SITE": "site"}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parse(remotesConfig + "remotes = { web = { " + tt.override + " } }\n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			shared := cfg.Remotes["web"]
+
+			got, ok := cfg.Remote(cfg.Projects["site"], "web")
+			if !ok {
+				t.Fatal("remote web not found")
+			}
+			want := cfg.Remotes["web"]
+			want.RsyncOptions = slices.Clone(want.RsyncOptions)
+			want.PostCommands = slices.Clone(want.PostCommands)
+			want.Env = maps.Clone(want.Env)
+			tt.want(&want)
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got  %+v\nwant %+v", got, want)
+			}
+			// Other projects still see the shared remote unchanged
+			if !reflect.DeepEqual(cfg.Remotes["web"], shared) || len(shared.RsyncOptions) != 1 ||
+				len(shared.PostCommands) != 1 || len(shared.Env) != 2 {
+				t.Errorf("the shared remote changed to %+v", cfg.Remotes["web"])
+			}
+		})
+	}
+}
+
+func TestHealthChecksValidate(t *testing.T) {
+	remote := Remote{Host: "example.com", User: "deploy", Path: "/srv/web", HealthChecks: []string{"curl -fsS http://localhost/", " "}}
+	if err := remote.Validate(); err == nil {
+		t.Error("an empty health check was accepted")
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// weekdays are the day names accepted in DeployWindow.Days, in the order
+// of time.Weekday.
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// DeployWindow limits deploys to a remote to certain days and hours.
+type DeployWindow struct {
+	// Days are the allowed days, such as ["mon", "tue"]. Empty allows every day.
+	Days []string `toml:"days"`
+	// Hours is the allowed time of day as "HH:MM-HH:MM". A window ending
+	// before it starts runs past midnight. Empty allows the whole day.
+	Hours string `toml:"hours"`
+	// Timezone is the IANA name the days and hours are in, such as
+	// "Europe/Rome". Empty uses the local time zone.
+	Timezone string `toml:"timezone"`
+}
+
+func (w *DeployWindow) Validate() error {
+	for _, day := range w.Days {
+		if !slices.Contains(weekdays, strings.ToLower(day)) {
+			return fmt.Errorf("invalid day %q: expected one of %s", day, strings.Join(weekdays, ", "))
+		}
+	}
+
+	if w.Hours != "" {
+		if _, _, err := w.hours(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.location(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Allows reports whether t falls inside the window. The hours of a window
+// running past midnight belong to the day it starts on.
+func (w *DeployWindow) Allows(t time.Time) (bool, error) {
+	loc, err := w.location()
+	if err != nil {
+		return false, err
+	}
+	t = t.In(loc)
+
+	if w.Hours == "" {
+		return w.allowsDay(t.Weekday()), nil
+	}
+
+	start, end, err := w.hours()
+	if err != nil {
+		return false, err
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	switch {
+	case start <= end:
+		if now < start || now >= end {
+			return false, nil
+		}
+	case now < end:
+		// Past midnight, still in the window started the day before
+		day = (day + 6) % 7
+	case now < start:
+		return false, nil
+	}
+	return w.allowsDay(day), nil
+}
+
+func (w *DeployWindow) allowsDay(day time.Weekday) bool {
+	return len(w.Days) == 0 || slices.ContainsFunc(w.Days, func(d string) bool {
+		return strings.EqualFold(d, weekdays[day])
+	})
+}
+
+func (w *DeployWindow) String() string {
+	parts := []string{"every day"}
+	if len(w.Days) > 0 {
+		parts[0] = strings.Join(w.Days, ", ")
+	}
+	if w.Hours != "" {
+		parts = append(parts, w.Hours)
+	}
+	if w.Timezone != "" {
+		parts = append(parts, w.Timezone)
+	}
+	return strings.Join(parts, " ")
+}
+
+// hours returns the start and end of the window in minutes after midnight.
+func (w *DeployWindow) hours() (int, int, error) {
+	from, to, ok := strings.Cut(w.Hours, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid hours %q: expected HH:MM-HH:MM", w.Hours)
+	}
+
+	start, err := time.Parse("15:04", strings.TrimSpace(from))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hours %q: expected HH:MM-HH:MM", w.Hours)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(to))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid hours %q: expected HH:MM-HH:MM", w.Hours)
+	}
+
+	return start.Hour()*60 + start.Minute(), end.Hour()*60 + end.Minute(), nil
+}
+
+func (w *DeployWindow) location() (*time.Location, error) {
+	if w.Timezone == "" {
+		return time.Local, nil
+	}
+
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", w.Timezone, err)
+	}
+	return loc, nil
+}
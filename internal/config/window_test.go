@@ -0,0 +1,74 @@
+package config
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestDeployWindowAllows(t *testing.T) {
+	// October 16, 2026 is a Friday; Rome is at UTC+2 and New York at UTC-4
+	utc := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+	}
+	office := DeployWindow{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Hours: "09:00-17:00", Timezone: "Europe/Rome"}
+	night := DeployWindow{Days: []string{"fri"}, Hours: "22:00-06:00", Timezone: "UTC"}
+
+	tests := []struct {
+		name   string
+		window DeployWindow
+		at     time.Time
+		want   bool
+	}{
+		{"empty window", DeployWindow{}, utc(17, 3, 0), true},
+		{"inside office hours", office, utc(16, 8, 0), true},
+		{"start is inclusive", office, utc(16, 7, 0), true},
+		{"end is exclusive", office, utc(16, 15, 0), false},
+		{"inside in UTC but after hours in Rome", office, utc(16, 15, 30), false},
+		{"before hours in UTC but inside in Rome", office, utc(16, 7, 30), true},
+		{"weekend", office, utc(17, 10, 0), false},
+		{"day is taken in the window's time zone", DeployWindow{Days: []string{"mon"}, Timezone: "Europe/Rome"}, utc(18, 23, 30), true},
+		{"day of the UTC instant elsewhere", DeployWindow{Days: []string{"sun"}, Timezone: "Europe/Rome"}, utc(18, 23, 30), false},
+		{"days ignore case", DeployWindow{Days: []string{"FRI"}, Timezone: "UTC"}, utc(16, 12, 0), true},
+		{"before midnight", night, utc(16, 23, 0), true},
+		{"past midnight belongs to the day before", night, utc(17, 1, 0), true},
+		{"end past midnight is exclusive", night, utc(17, 6, 0), false},
+		{"past midnight after a day not allowed", night, utc(16, 1, 0), false},
+		{"between the end and the start", night, utc(16, 12, 0), false},
+		{"start of the next night on a day not allowed", night, utc(17, 23, 0), false},
+		{"midnight window on any day", DeployWindow{Hours: "22:00-06:00", Timezone: "UTC"}, utc(14, 5, 59), true},
+		{"before opening in New York", DeployWindow{Hours: "09:00-17:00", Timezone: "America/New_York"}, utc(16, 12, 0), false},
+		{"opening in New York", DeployWindow{Hours: "09:00-17:00", Timezone: "America/New_York"}, utc(16, 13, 0), true},
+		{"local time zone", DeployWindow{Hours: "09:00-17:00"}, time.Date(2026, time.October, 16, 10, 0, 0, 0, time.Local), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.window.Allows(tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("%s allows %s = %v, want %v", &tt.window, tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeployWindowAllowsInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		window DeployWindow
+	}{
+		{"unknown time zone", DeployWindow{Timezone: "Mars/Olympus_Mons"}},
+		{"malformed hours", DeployWindow{Hours: "9-5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.window.Allows(time.Now()); err == nil {
+				t.Errorf("%s was accepted", &tt.window)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Package events carries typed progress events from every part of a deploy
+// to whoever is watching, such as the NDJSON stream of --events.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is one of the event types below.
+type Event interface {
+	// Type is the name of the event in serialized form.
+	Type() string
+}
+
+// PhaseStarted is published when a deploy phase begins.
+type PhaseStarted struct {
+	Phase string `json:"phase"`
+}
+
+// PhaseFinished is published when a phase ends, or is skipped because an
+// earlier one failed. Status is "succeeded", "failed" or "skipped".
+type PhaseFinished struct {
+	Phase      string `json:"phase"`
+	Status     string `json:"status"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CommandStarted is published when a local command, remote command or
+// rsync starts. Source is "local", "rsync" or the remote host.
+type CommandStarted struct {
+	Source  string `json:"source"`
+	Command string `json:"command"`
+}
+
+// OutputLine is a single line of output from a running command.
+type OutputLine struct {
+	Source  string `json:"source"`
+	Command string `json:"command"`
+	Line    string `json:"line"`
+}
+
+// CommandExited is published when a command ends. ExitCode is -1 when the
+// command did not run to completion, for example after a lost connection.
+type CommandExited struct {
+	Source     string `json:"source"`
+	Command    string `json:"command"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// SyncProgress reports how far the running rsync transfer is.
+type SyncProgress struct {
+	Bytes   int64  `json:"bytes"`
+	Percent int    `json:"percent"`
+	Rate    string `json:"rate"`
+	ETA     string `json:"eta"`
+}
+
+// HealthCheck is the result of one of a remote's health checks, run once
+// its post commands are done.
+type HealthCheck struct {
+	Remote     string `json:"remote"`
+	Check      string `json:"check"`
+	OK         bool   `json:"ok"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+func (PhaseStarted) Type() string   { return "phase_started" }
+func (PhaseFinished) Type() string  { return "phase_finished" }
+func (CommandStarted) Type() string { return "command_started" }
+func (OutputLine) Type() string     { return "output_line" }
+func (CommandExited) Type() string  { return "command_exited" }
+func (SyncProgress) Type() string   { return "sync_progress" }
+func (HealthCheck) Type() string    { return "health_check" }
+
+// Bus delivers every published event to all subscribers, one event at a
+// time and in publishing order. A nil *Bus discards events, so publishers
+// need no checks.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers []func(Event)
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe registers fn to receive every event published from now on.
+// Subscribers run synchronously and must not publish themselves.
+func (b *Bus) Subscribe(fn func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, fn)
+}
+
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, fn := range b.subscribers {
+		fn(e)
+	}
+}
+
+// Exited builds the CommandExited event for a command started at started.
+func Exited(source, command string, started time.Time, code int, err error) CommandExited {
+	e := CommandExited{
+		Source:     source,
+		Command:    command,
+		ExitCode:   code,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
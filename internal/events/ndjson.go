@@ -0,0 +1,111 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// NDJSON returns a subscriber writing each event to w as a single JSON
+// line, with its type and time added:
+//
+//	{"type":"command_started","time":"...","source":"local","command":"make"}
+//
+// Write errors are ignored: a watcher going away must not fail the deploy.
+func NDJSON(w io.Writer) func(Event) {
+	return func(e Event) {
+		line, err := encode(e, time.Now())
+		if err != nil {
+			return
+		}
+		w.Write(line)
+	}
+}
+
+// NDJSONQueue is NDJSON for destinations that may be slow, such as a socket
+// whose reader falls behind. Events are encoded as they are published and
+// queued for a goroutine to write, so the deploy never waits on the reader;
+// once size lines are waiting, further events are dropped.
+//
+// The returned stop function ends the subscription and waits up to wait
+// for the queue to be written. It returns how many events were dropped.
+func NDJSONQueue(w io.Writer, size int) (func(Event), func(wait time.Duration) int) {
+	lines := make(chan []byte, size)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		for line := range lines {
+			w.Write(line)
+		}
+	}()
+
+	var (
+		mu      sync.Mutex
+		stopped bool
+		dropped int
+	)
+	subscriber := func(e Event) {
+		line, err := encode(e, time.Now())
+		if err != nil {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			dropped++
+			return
+		}
+		select {
+		case lines <- line:
+		default:
+			dropped++
+		}
+	}
+
+	stop := func(wait time.Duration) int {
+		mu.Lock()
+		if !stopped {
+			stopped = true
+			close(lines)
+		}
+		mu.Unlock()
+
+		select {
+		case <-written:
+		case <-time.After(wait):
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		return dropped
+	}
+
+	return subscriber, stop
+}
+
+func encode(e Event, at time.Time) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := json.Marshal(struct {
+		Type string    `json:"type"`
+		Time time.Time `json:"time"`
+	}{e.Type(), at.UTC()})
+	if err != nil {
+		return nil, err
+	}
+
+	// Splice the event's own fields in after type and time
+	line := header[:len(header)-1]
+	if len(data) > 2 {
+		line = append(line, ',')
+		line = append(line, data[1:]...)
+	} else {
+		line = append(line, '}')
+	}
+	return append(line, '\n'), nil
+}
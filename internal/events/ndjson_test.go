@@ -0,0 +1,94 @@
+package events
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedWriter signals writing on its first write and blocks every write
+// until gate is closed.
+type gatedWriter struct {
+	writing chan struct{}
+	gate    chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (w *gatedWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.writing) })
+	<-w.gate
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *gatedWriter) lines() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.Count(w.buf.String(), "\n")
+}
+
+func TestNDJSONQueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		size        int
+		published   int
+		open        bool
+		wantDropped int
+		wantLines   int
+	}{
+		{"queue has room", 4, 5, true, 0, 5},
+		// The writer holds the first line and size more are queued
+		{"reader falls behind", 2, 6, true, 3, 3},
+		{"reader never reads", 2, 6, false, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &gatedWriter{writing: make(chan struct{}), gate: make(chan struct{})}
+			subscriber, stop := NDJSONQueue(w, tt.size)
+			bus := NewBus()
+			bus.Subscribe(subscriber)
+
+			bus.Publish(PhaseStarted{Phase: "first"})
+			<-w.writing
+
+			published := make(chan struct{})
+			go func() {
+				for range tt.published - 1 {
+					bus.Publish(PhaseStarted{Phase: "next"})
+				}
+				close(published)
+			}()
+			select {
+			case <-published:
+			case <-time.After(5 * time.Second):
+				t.Fatal("publishing waited on the writer")
+			}
+
+			if tt.open {
+				close(w.gate)
+			}
+			if dropped := stop(100 * time.Millisecond); dropped != tt.wantDropped {
+				t.Errorf("dropped %d events, want %d", dropped, tt.wantDropped)
+			}
+			if got := w.lines(); got != tt.wantLines {
+				t.Errorf("wrote %d lines, want %d", got, tt.wantLines)
+			}
+
+			// Events published after stop are dropped as well
+			bus.Publish(PhaseStarted{Phase: "late"})
+			if dropped := stop(0); dropped != tt.wantDropped+1 {
+				t.Errorf("dropped %d events with a late one, want %d", dropped, tt.wantDropped+1)
+			}
+
+			if !tt.open {
+				close(w.gate)
+			}
+		})
+	}
+}
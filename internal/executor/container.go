@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// runtimes are the container CLIs looked for, in order, when none is
+// configured.
+var runtimes = []string{"docker", "podman"}
+
+// Container runs commands in a throwaway container of Image with the
+// working directory mounted at the same path, as the current user so that
+// files it writes are owned by them.
+type Container struct {
+	// CLI is the docker or podman binary, or any with the same interface.
+	CLI   string
+	Image string
+	// Podman is set when CLI is podman, which maps the user itself.
+	Podman bool
+}
+
+// NewContainer returns a runner for image using the given container CLI,
+// or docker or podman, whichever is found first, when runtime is empty.
+func NewContainer(runtime, image string) (*Container, error) {
+	candidates := runtimes
+	if runtime != "" {
+		candidates = []string{runtime}
+	}
+
+	for _, candidate := range candidates {
+		if path, err := exec.LookPath(candidate); err == nil {
+			return &Container{CLI: path, Image: image, Podman: isPodman(path)}, nil
+		}
+	}
+
+	if runtime != "" {
+		return nil, fmt.Errorf("container runtime not found: %s", runtime)
+	}
+	return nil, fmt.Errorf("no container runtime found: install docker or podman, or set build_runtime")
+}
+
+// isPodman asks cli for its version, as podman is often installed under
+// the name docker.
+func isPodman(cli string) bool {
+	out, err := exec.Command(cli, "--version").Output()
+	return err == nil && strings.Contains(strings.ToLower(string(out)), "podman")
+}
+
+func (c *Container) Command(parts []string, workDir string, env []string) *exec.Cmd {
+	return exec.Command(c.CLI, c.Args(parts, workDir, env)...)
+}
+
+// Args returns the arguments of the container CLI running parts.
+func (c *Container) Args(parts []string, workDir string, env []string) []string {
+	// Volumes need absolute paths
+	if abs, err := filepath.Abs(workDir); err == nil {
+		workDir = abs
+	}
+
+	args := []string{"run", "--rm", "-v", workDir + ":" + workDir, "-w", workDir}
+
+	// Rootless podman maps the user itself, while docker runs as root
+	// unless told otherwise
+	if c.Podman {
+		args = append(args, "--userns=keep-id")
+	} else if uid, gid := os.Getuid(), os.Getgid(); uid >= 0 {
+		args = append(args, "--user", strconv.Itoa(uid)+":"+strconv.Itoa(gid), "-e", "HOME=/tmp")
+	}
+
+	for _, pair := range env {
+		args = append(args, "-e", pair)
+	}
+
+	args = append(args, c.Image)
+	return append(args, parts...)
+}
@@ -0,0 +1,104 @@
+package executor
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"deeployer/internal/output"
+)
+
+// fakeRuntime writes a container CLI to dir that prints version for
+// --version and otherwise appends its arguments, one per line followed by
+// a blank line, to the returned log.
+func fakeRuntime(t *testing.T, dir, version string) (cli, log string) {
+	t.Helper()
+
+	cli = filepath.Join(dir, "runtime")
+	log = filepath.Join(dir, "argv.log")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = --version ]; then echo '" + version + "'; exit 0; fi\n" +
+		"for arg in \"$@\"; do printf '%s\\n' \"$arg\" >> '" + log + "'; done\n" +
+		"echo >> '" + log + "'\n"
+	if err := os.WriteFile(cli, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return cli, log
+}
+
+func TestContainerArgv(t *testing.T) {
+	user := []string{"--user", strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid()), "-e", "HOME=/tmp"}
+
+	tests := []struct {
+		name    string
+		version string
+		user    []string
+	}{
+		{"docker", "Docker version 27.3.1, build ce12230", user},
+		{"podman", "podman version 5.2.2", []string{"--userns=keep-id"}},
+		{"podman as docker", "Podman Engine version 5.2.2", []string{"--userns=keep-id"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cli, log := fakeRuntime(t, dir, tt.version)
+
+			e := &Executor{Output: output.NewSink(io.Discard, output.DefaultLimit)}
+			e, err := e.WithContainer(cli, "node:20")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			env := []string{"DEEPLOYER_PROJECT=webapp", "DEEPLOYER_REMOTE=production"}
+			for _, command := range []string{"npm ci", "npm run 'build prod'"} {
+				if err := e.Run(command, dir, env); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			data, err := os.ReadFile(log)
+			if err != nil {
+				t.Fatal(err)
+			}
+			calls := strings.Split(strings.TrimSuffix(string(data), "\n\n"), "\n\n")
+
+			prefix := slices.Concat([]string{"run", "--rm", "-v", dir + ":" + dir, "-w", dir}, tt.user,
+				[]string{"-e", env[0], "-e", env[1], "node:20"})
+			want := [][]string{
+				slices.Concat(prefix, []string{"npm", "ci"}),
+				slices.Concat(prefix, []string{"npm", "run", "build prod"}),
+			}
+
+			if len(calls) != len(want) {
+				t.Fatalf("got %d runs, want %d:\n%s", len(calls), len(want), data)
+			}
+			for i, call := range calls {
+				if got := strings.Split(call, "\n"); !slices.Equal(got, want[i]) {
+					t.Errorf("run %d:\ngot  %q\nwant %q", i, got, want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWithContainerWithoutImage(t *testing.T) {
+	e := New(false, false)
+	got, err := e.WithContainer("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != e || got.Runner != nil {
+		t.Errorf("WithContainer without an image changed the executor")
+	}
+}
+
+func TestNewContainerMissingRuntime(t *testing.T) {
+	if _, err := NewContainer(filepath.Join(t.TempDir(), "missing"), "node:20"); err == nil {
+		t.Error("NewContainer with a missing runtime succeeded")
+	}
+}
@@ -1,23 +1,72 @@
 package executor
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 
+	"deeployer/internal/events"
+	"deeployer/internal/output"
+
 	"github.com/google/shlex"
 )
 
 type Executor struct {
 	DryRun  bool
 	Verbose bool
+	Output  *output.Sink
+	Events  *events.Bus
+
+	// Runner starts the commands, on this machine when nil.
+	Runner Runner
+}
+
+// Runner turns a parsed command into the process running it.
+type Runner interface {
+	Command(parts []string, workDir string, env []string) *exec.Cmd
+}
+
+// Local runs commands directly on this machine.
+type Local struct{}
+
+func (Local) Command(parts []string, workDir string, env []string) *exec.Cmd {
+	cmd := exec.Command(parts[0], parts[1:]...)
+	cmd.Dir = workDir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
 }
 
 func New(dryRun, verbose bool) *Executor {
 	return &Executor{
 		DryRun:  dryRun,
 		Verbose: verbose,
+		Output:  output.NewSink(os.Stdout, output.DefaultLimit),
+	}
+}
+
+// With returns a copy of the executor that starts commands with runner.
+func (e *Executor) With(runner Runner) *Executor {
+	with := *e
+	with.Runner = runner
+	return &with
+}
+
+// WithContainer returns a copy of the executor that runs commands in a
+// container of image, as NewContainer finds it, or the executor itself when
+// image is empty.
+func (e *Executor) WithContainer(runtime, image string) (*Executor, error) {
+	if image == "" {
+		return e, nil
+	}
+
+	container, err := NewContainer(runtime, image)
+	if err != nil {
+		return nil, err
 	}
+	return e.With(container), nil
 }
 
 func (e *Executor) ExecuteCommands(commands []string, workDir string) error {
@@ -26,17 +75,27 @@ func (e *Executor) ExecuteCommands(commands []string, workDir string) error {
 	}
 
 	for _, command := range commands {
-		if err := e.executeCommand(command, workDir); err != nil {
-			return fmt.Errorf("command failed: %s: %w", command, err)
+		if err := e.Run(command, workDir, nil); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func (e *Executor) executeCommand(command, workDir string) error {
+// Run executes a single command in workDir. Env holds KEY=value pairs
+// added to the environment inherited from deeployer.
+func (e *Executor) Run(command, workDir string, env []string) error {
+	if err := e.executeCommand(command, workDir, env); err != nil {
+		return fmt.Errorf("command failed: %s: %w", command, err)
+	}
+
+	return nil
+}
+
+func (e *Executor) executeCommand(command, workDir string, env []string) error {
 	if e.Verbose || e.DryRun {
-		fmt.Printf("Executing: %s\n", command)
+		e.Output.Printf("Executing: %s\n", command)
 	}
 
 	if e.DryRun {
@@ -52,17 +111,42 @@ func (e *Executor) executeCommand(command, workDir string) error {
 		return fmt.Errorf("empty command")
 	}
 
-	cmd := exec.Command(parts[0], parts[1:]...)
-	cmd.Dir = workDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	step := e.Output.Step("local", command)
+	e.Events.Publish(events.CommandStarted{Source: "local", Command: command})
 
-	return cmd.Run()
+	var runner Runner = Local{}
+	if e.Runner != nil {
+		runner = e.Runner
+	}
+
+	cmd := runner.Command(parts, workDir, env)
+	cmd.Stdout = step
+	cmd.Stderr = step
+
+	err = cmd.Run()
+	step.Finish(err)
+	e.Events.Publish(events.Exited("local", command, step.StartedAt, exitCode(err), err))
+
+	return err
+}
+
+// exitCode returns the status a command exited with, or -1 when it could
+// not be started or was killed by a signal.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
 }
 
 func (e *Executor) CheckOutputDir(outputDir string) error {
 	if e.Verbose {
-		fmt.Printf("Checking output directory: %s\n", outputDir)
+		e.Output.Printf("Checking output directory: %s\n", outputDir)
 	}
 
 	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
@@ -0,0 +1,165 @@
+// Package git reads the state of a project's repository with the git
+// command line.
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Commit identifies a single commit.
+type Commit struct {
+	SHA     string
+	Short   string
+	Subject string
+}
+
+// Head returns the commit checked out in dir.
+func Head(dir string) (Commit, error) {
+	return Resolve(dir, "HEAD")
+}
+
+// Resolve returns the commit that rev, such as a tag, branch or SHA, names
+// in the repository at dir.
+func Resolve(dir, rev string) (Commit, error) {
+	out, err := run(dir, "log", "-1", "--format=%H%x00%h%x00%s", rev+"^{commit}", "--")
+	if err != nil {
+		return Commit{}, err
+	}
+
+	fields := strings.SplitN(out, "\x00", 3)
+	if len(fields) != 3 {
+		return Commit{}, fmt.Errorf("unexpected git log output: %q", out)
+	}
+
+	return Commit{SHA: fields[0], Short: fields[1], Subject: fields[2]}, nil
+}
+
+// Dirty reports whether the working tree in dir has uncommitted changes,
+// including untracked files.
+func Dirty(dir string) (bool, error) {
+	out, err := run(dir, "status", "--porcelain")
+	if err != nil {
+		return false, err
+	}
+
+	return out != "", nil
+}
+
+// Branch returns the branch checked out in dir, or "" when HEAD is
+// detached.
+func Branch(dir string) (string, error) {
+	out, err := run(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	if out == "HEAD" {
+		return "", nil
+	}
+	return out, nil
+}
+
+// Unpushed returns how many commits in dir are not on the upstream of the
+// current branch. It fails when the branch has no upstream.
+func Unpushed(dir string) (int, error) {
+	if _, err := run(dir, "rev-parse", "--abbrev-ref", "@{upstream}"); err != nil {
+		return 0, err
+	}
+
+	out, err := run(dir, "rev-list", "--count", "@{upstream}..HEAD")
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := strconv.Atoi(out)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected git rev-list output: %q", out)
+	}
+	return count, nil
+}
+
+// Signed reports whether rev in dir has a good signature. Checking it
+// needs the signer's key to be known to gpg or to gpg.ssh.allowedSignersFile.
+func Signed(dir, rev string) (bool, error) {
+	out, err := run(dir, "log", "-1", "--format=%G?", rev, "--")
+	if err != nil {
+		return false, err
+	}
+
+	// G is a good signature, U a good one from a key of unknown validity
+	return out == "G" || out == "U", nil
+}
+
+// Tags returns the tags pointing at rev in dir.
+func Tags(dir, rev string) ([]string, error) {
+	return lines(run(dir, "tag", "--points-at", rev))
+}
+
+// Branches returns the local branches, or with remote the remote-tracking
+// branches, that contain rev.
+func Branches(dir, rev string, remote bool) ([]string, error) {
+	refs := "refs/heads"
+	if remote {
+		refs = "refs/remotes"
+	}
+	return lines(run(dir, "for-each-ref", "--contains", rev, "--format=%(refname:short)", refs))
+}
+
+// Root returns the top-level directory of the repository containing dir.
+func Root(dir string) (string, error) {
+	return run(dir, "rev-parse", "--show-toplevel")
+}
+
+// AddWorktree checks out rev, detached, in a new temporary worktree of the
+// repository at dir and returns its path. RemoveWorktree deletes it again.
+func AddWorktree(dir, rev string) (string, error) {
+	path, err := os.MkdirTemp("", "deeployer-worktree-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+
+	if _, err := run(dir, "worktree", "add", "--detach", path, rev); err != nil {
+		os.RemoveAll(path)
+		return "", err
+	}
+
+	return path, nil
+}
+
+// RemoveWorktree deletes a worktree made by AddWorktree, together with
+// anything built in it.
+func RemoveWorktree(dir, path string) error {
+	if _, err := run(dir, "worktree", "remove", "--force", path); err != nil {
+		os.RemoveAll(path)
+		return err
+	}
+	return nil
+}
+
+func lines(out string, err error) ([]string, error) {
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+func run(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
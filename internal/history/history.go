@@ -0,0 +1,89 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Record describes one deploy of a project to a remote.
+type Record struct {
+	Project    string    `json:"project"`
+	Remote     string    `json:"remote"`
+	Commit     string    `json:"commit,omitempty"`
+	Ref        string    `json:"ref,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	Transfer   *Transfer `json:"transfer,omitempty"`
+	Steps      []Step    `json:"steps"`
+}
+
+// Transfer summarizes the files changed on the remote by the sync.
+type Transfer struct {
+	Created          int   `json:"created"`
+	Updated          int   `json:"updated"`
+	Deleted          int   `json:"deleted"`
+	FilesTransferred int   `json:"files_transferred"`
+	TotalSize        int64 `json:"total_size"`
+	TransferredSize  int64 `json:"transferred_size"`
+	BytesSent        int64 `json:"bytes_sent"`
+	BytesReceived    int64 `json:"bytes_received"`
+}
+
+// Step is a command run during a deploy together with its captured output.
+type Step struct {
+	Label      string    `json:"label"`
+	Name       string    `json:"name"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Error      string    `json:"error,omitempty"`
+	Output     string    `json:"output,omitempty"`
+	Truncated  bool      `json:"truncated,omitempty"`
+}
+
+// Path returns the history file, $XDG_STATE_HOME/deeployer/history.jsonl.
+func Path() (string, error) {
+	stateDir := os.Getenv("XDG_STATE_HOME")
+	if stateDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		stateDir = filepath.Join(homeDir, ".local", "state")
+	}
+
+	return filepath.Join(stateDir, "deeployer", "history.jsonl"), nil
+}
+
+// Append adds record to the history file as a single JSON line.
+func Append(record Record) error {
+	historyPath, err := Path()
+	if err != nil {
+		return fmt.Errorf("failed to get history path: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(historyPath), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode deploy record: %w", err)
+	}
+
+	file, err := os.OpenFile(historyPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+
+	return nil
+}
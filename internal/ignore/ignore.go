@@ -0,0 +1,281 @@
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileName is the ignore file read from the root of a project.
+const FileName = ".deeployignore"
+
+// Rule is a single pattern in gitignore syntax.
+type Rule struct {
+	Pattern  string
+	Negate   bool
+	DirOnly  bool
+	Anchored bool
+}
+
+// Rules is an ordered list of patterns where, as in gitignore, the last
+// matching rule decides whether a path is excluded.
+type Rules struct {
+	rules []Rule
+}
+
+// Load reads the rules for a project: its .deeployignore, the files listed
+// in excludeFrom, then the exclude patterns, and finally the include
+// patterns, which re-include paths excluded by anything before them.
+func Load(projectPath string, excludeFrom, exclude, include []string) (*Rules, error) {
+	rules := &Rules{}
+
+	if err := rules.AddFile(filepath.Join(projectPath, FileName)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, file := range excludeFrom {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(projectPath, file)
+		}
+		if err := rules.AddFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pattern := range exclude {
+		rules.Add(pattern)
+	}
+
+	for _, pattern := range include {
+		rules.Add("!" + strings.TrimPrefix(pattern, "!"))
+	}
+
+	return rules, nil
+}
+
+// AddFile appends every pattern in a gitignore-style file.
+func (r *Rules) AddFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r.Add(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	return nil
+}
+
+// Add appends a single pattern. Blank lines and comments are ignored.
+func (r *Rules) Add(line string) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	var rule Rule
+	if strings.HasPrefix(line, "!") {
+		rule.Negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.DirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// A leading **/ matches in every directory
+	anywhere := false
+	for strings.HasPrefix(line, "**/") {
+		line = line[3:]
+		anywhere = true
+	}
+
+	// Other patterns with a slash are relative to the root
+	if !anywhere && strings.Contains(line, "/") {
+		rule.Anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return
+	}
+
+	rule.Pattern = line
+	r.rules = append(r.rules, rule)
+}
+
+// Patterns returns the rules as lines that Add turns back into the same
+// rules, so they can be stored and loaded elsewhere.
+func (r *Rules) Patterns() []string {
+	if r == nil {
+		return nil
+	}
+
+	patterns := make([]string, 0, len(r.rules))
+	for _, rule := range r.rules {
+		pattern := rule.Pattern
+		switch {
+		case rule.Anchored:
+			pattern = "/" + pattern
+		case strings.Contains(pattern, "/"):
+			pattern = "**/" + pattern
+		case !rule.Negate && (strings.HasPrefix(pattern, "#") || strings.HasPrefix(pattern, "!")):
+			pattern = `\` + pattern
+		}
+		if rule.DirOnly {
+			pattern += "/"
+		}
+		if rule.Negate {
+			pattern = "!" + pattern
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns
+}
+
+// Empty reports whether there are no rules.
+func (r *Rules) Empty() bool {
+	return r == nil || len(r.rules) == 0
+}
+
+// Excluded reports whether relPath, relative to the transfer root, is
+// excluded. Paths inside an excluded directory are not checked here;
+// callers walking a tree should skip excluded directories entirely.
+func (r *Rules) Excluded(relPath string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	excluded := false
+	for _, rule := range r.rules {
+		if rule.DirOnly && !isDir {
+			continue
+		}
+		if rule.matches(relPath) {
+			excluded = !rule.Negate
+		}
+	}
+
+	return excluded
+}
+
+func (rule Rule) matches(relPath string) bool {
+	pattern := strings.Split(rule.Pattern, "/")
+	segments := strings.Split(relPath, "/")
+
+	if rule.Anchored {
+		return matchSegments(pattern, segments)
+	}
+
+	// Unanchored patterns match the trailing segments of the path
+	for i := len(segments) - len(pattern); i >= 0; i-- {
+		if matchSegments(pattern, segments[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" segment matches any number of path segments.
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// A trailing ** matches everything inside, but not the directory
+			if len(pattern) == 1 {
+				return len(segments) > 0
+			}
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(segments) == 0 {
+			return false
+		}
+
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// RsyncFilters translates the rules into rsync filter rules. rsync stops
+// at the first matching rule, so the order is reversed to keep the
+// last-match-wins semantics.
+func (r *Rules) RsyncFilters() []string {
+	if r == nil {
+		return nil
+	}
+
+	filters := make([]string, 0, len(r.rules))
+	for i := len(r.rules) - 1; i >= 0; i-- {
+		rule := r.rules[i]
+
+		pattern := rule.Pattern
+		if rule.Anchored {
+			pattern = "/" + pattern
+		}
+		if rule.DirOnly {
+			pattern += "/"
+		}
+
+		if rule.Negate {
+			filters = append(filters, "+ "+pattern)
+		} else {
+			filters = append(filters, "- "+pattern)
+		}
+	}
+
+	return filters
+}
+
+// Walk calls fn for every path under root that is not excluded, skipping
+// excluded directories together with their contents. Paths passed to fn
+// are relative to root and slash-separated.
+func Walk(root string, rules *Rules, fn func(relPath string, d fs.DirEntry) error) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if relPath == "." {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		if rules.Excluded(relPath, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		return fn(relPath, d)
+	})
+}
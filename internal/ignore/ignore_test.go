@@ -0,0 +1,85 @@
+package ignore
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRsyncFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+	}{
+		{
+			name:     "plain pattern",
+			patterns: []string{"*.map"},
+			want:     []string{"- *.map"},
+		},
+		{
+			name:     "later rules come first",
+			patterns: []string{"*.log", "debug/", "tmp"},
+			want:     []string{"- tmp", "- debug/", "- *.log"},
+		},
+		{
+			name:     "negation",
+			patterns: []string{"*.env", "!example.env"},
+			want:     []string{"+ example.env", "- *.env"},
+		},
+		{
+			name:     "anchored with a leading slash",
+			patterns: []string{"/build"},
+			want:     []string{"- /build"},
+		},
+		{
+			name:     "anchored by an inner slash",
+			patterns: []string{"docs/drafts"},
+			want:     []string{"- /docs/drafts"},
+		},
+		{
+			name:     "trailing slash matches directories only",
+			patterns: []string{"cache/", "/logs/"},
+			want:     []string{"- /logs/", "- cache/"},
+		},
+		{
+			name:     "leading ** matches anywhere",
+			patterns: []string{"**/node_modules", "**/a/b"},
+			want:     []string{"- a/b", "- node_modules"},
+		},
+		{
+			name:     "inner ** stays anchored",
+			patterns: []string{"src/**/*.test.js"},
+			want:     []string{"- /src/**/*.test.js"},
+		},
+		{
+			name:     "trailing **",
+			patterns: []string{"vendor/**", "!vendor/keep/"},
+			want:     []string{"+ /vendor/keep/", "- /vendor/**"},
+		},
+		{
+			name:     "escaped characters, comments and blank lines",
+			patterns: []string{"# comment", "", `\#notes`, `\!important`},
+			want:     []string{"- !important", "- #notes"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := &Rules{}
+			for _, pattern := range tt.patterns {
+				rules.Add(pattern)
+			}
+
+			if got := rules.RsyncFilters(); !slices.Equal(got, tt.want) {
+				t.Errorf("RsyncFilters(%q)\ngot  %q\nwant %q", tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRsyncFiltersNil(t *testing.T) {
+	var rules *Rules
+	if got := rules.RsyncFilters(); got != nil {
+		t.Errorf("nil rules gave filters %q", got)
+	}
+}
@@ -0,0 +1,89 @@
+package manifest
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"strings"
+
+	"deeployer/internal/ssh"
+)
+
+// ChangeKind says how a file on a remote differs from what was deployed.
+type ChangeKind string
+
+const (
+	Added    ChangeKind = "added"
+	Modified ChangeKind = "modified"
+	Deleted  ChangeKind = "deleted"
+)
+
+// Change is a file that differs on a remote.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	Path string     `json:"path"`
+}
+
+// Compare returns how the actual files differ from the expected ones, both
+// mapping paths to content hashes, sorted by path.
+func Compare(expected, actual map[string]string) []Change {
+	var changes []Change
+	for path, sum := range actual {
+		want, ok := expected[path]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: Added, Path: path})
+		case want != sum:
+			changes = append(changes, Change{Kind: Modified, Path: path})
+		}
+	}
+	for path := range expected {
+		if _, ok := actual[path]; !ok {
+			changes = append(changes, Change{Kind: Deleted, Path: path})
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b Change) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return changes
+}
+
+// ChecksumCommand prints the SHA-256 of every regular file under the
+// current directory except the manifest and the skipped paths, relative to
+// that directory, in the format ParseChecksums reads.
+func ChecksumCommand(skip ...string) string {
+	prune := "-path ./" + Dir
+	for _, p := range skip {
+		prune += " -o -path " + ssh.Quote("./"+p)
+	}
+	return `if command -v sha256sum >/dev/null 2>&1; then sum="sha256sum"; else sum="shasum -a 256"; fi; ` +
+		`find . \( ` + prune + ` \) -prune -o -type f -exec $sum {} +`
+}
+
+// ParseChecksums reads the output of sha256sum, or shasum -a 256, run on
+// paths starting with "./".
+func ParseChecksums(out string) (map[string]string, error) {
+	sums := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		sum, path, ok := strings.Cut(line, " ")
+		if !ok || len(sum) != 64 {
+			return nil, fmt.Errorf("unexpected checksum line: %q", line)
+		}
+		// Binary mode marks the path with *
+		path = strings.TrimPrefix(strings.TrimPrefix(path, " "), "*")
+		sums[strings.TrimPrefix(path, "./")] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return sums, nil
+}
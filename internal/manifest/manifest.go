@@ -0,0 +1,183 @@
+// Package manifest describes the release a remote is running. A manifest
+// is written next to the synced files after every deploy and read back by
+// the status command.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"deeployer/internal/ignore"
+)
+
+// Dir is the directory, relative to the remote path, holding the manifest.
+const Dir = ".deeployer"
+
+// Path is the manifest file relative to the remote path.
+const Path = Dir + "/manifest.json"
+
+// Manifest records what was deployed to a remote, when and by whom.
+type Manifest struct {
+	Project      string    `json:"project"`
+	Remote       string    `json:"remote"`
+	Commit       string    `json:"commit,omitempty"`
+	Ref          string    `json:"ref,omitempty"`
+	DeployedBy   string    `json:"deployed_by"`
+	DeployedFrom string    `json:"deployed_from"`
+	DeployedAt   time.Time `json:"deployed_at"`
+	TreeHash     string    `json:"tree_hash"`
+
+	// Files maps the path of every synced regular file to the SHA-256 of
+	// its contents.
+	Files map[string]string `json:"files,omitempty"`
+}
+
+// Tree is the hashed contents of a directory.
+type Tree struct {
+	Hash  string
+	Files map[string]string
+}
+
+// New returns a manifest of tree, deployed now by the current user from
+// this host.
+func New(project, remote, commit, ref string, tree Tree) Manifest {
+	m := Manifest{
+		Project:    project,
+		Remote:     remote,
+		Commit:     commit,
+		Ref:        ref,
+		DeployedAt: time.Now().UTC(),
+		TreeHash:   tree.Hash,
+		Files:      tree.Files,
+	}
+
+	if u, err := user.Current(); err == nil {
+		m.DeployedBy = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		m.DeployedFrom = host
+	}
+
+	return m
+}
+
+// Parse reads a manifest written by Marshal.
+func Parse(data []byte) (Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Marshal encodes the manifest as indented JSON.
+func (m Manifest) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Source is a synced file or directory, the path relative to the remote
+// path that it was synced to and the rules excluding files from it.
+type Source struct {
+	Root   string
+	Prefix string
+	Rules  *ignore.Rules
+}
+
+// HashTree hashes the paths, file contents and symlink targets under root
+// that rules do not exclude, so that two trees hash the same exactly when
+// a sync would make them the same.
+func HashTree(root string, rules *ignore.Rules) (Tree, error) {
+	return HashSources([]Source{{Root: root, Rules: rules}})
+}
+
+// HashSources hashes several sources as one tree, as HashTree does, with
+// every path given relative to the remote path.
+func HashSources(sources []Source) (Tree, error) {
+	tree := sha256.New()
+	files := make(map[string]string)
+
+	for _, source := range sources {
+		info, err := os.Stat(source.Root)
+		if err != nil {
+			return Tree{}, fmt.Errorf("failed to hash %s: %w", source.Root, err)
+		}
+
+		if !info.IsDir() {
+			sum, err := fileHash(source.Root)
+			if err != nil {
+				return Tree{}, fmt.Errorf("failed to hash %s: %w", source.Root, err)
+			}
+			relPath := FilePath(source.Prefix, source.Root)
+			fmt.Fprintf(tree, "file %s %s\n", relPath, sum)
+			files[relPath] = sum
+			continue
+		}
+
+		err = ignore.Walk(source.Root, source.Rules, func(relPath string, d fs.DirEntry) error {
+			destPath := path.Join(source.Prefix, relPath)
+			switch {
+			case d.IsDir():
+				fmt.Fprintf(tree, "dir %s\n", destPath)
+
+			case d.Type()&fs.ModeSymlink != 0:
+				target, err := os.Readlink(filepath.Join(source.Root, relPath))
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(tree, "link %s %s\n", destPath, target)
+
+			case d.Type().IsRegular():
+				sum, err := fileHash(filepath.Join(source.Root, relPath))
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(tree, "file %s %s\n", destPath, sum)
+				files[destPath] = sum
+			}
+			return nil
+		})
+		if err != nil {
+			return Tree{}, fmt.Errorf("failed to hash %s: %w", source.Root, err)
+		}
+	}
+
+	return Tree{Hash: "sha256:" + hex.EncodeToString(tree.Sum(nil)), Files: files}, nil
+}
+
+// FilePath returns where a single file is synced to given the prefix it
+// is synced to: the prefix itself, or the file's name inside it when the
+// prefix is empty or ends with a slash.
+func FilePath(prefix, file string) string {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return prefix + filepath.Base(file)
+	}
+	return prefix
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,183 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"deeployer/internal/events"
+)
+
+// DefaultLimit is the number of bytes of output kept for each step.
+const DefaultLimit = 64 * 1024
+
+// Sink receives the output of every step of a run. Each line is written to
+// the destination prefixed with a timestamp and the step's label, and the
+// tail of every step's output is kept for later reporting.
+type Sink struct {
+	// Events, when set, receives every line as an events.OutputLine.
+	Events *events.Bus
+
+	mu    sync.Mutex
+	dst   io.Writer
+	limit int
+	steps []*Step
+}
+
+func NewSink(dst io.Writer, limit int) *Sink {
+	return &Sink{
+		dst:   dst,
+		limit: limit,
+	}
+}
+
+// Printf writes a message for people, such as a verbose log line, outside
+// of any step.
+func (s *Sink) Printf(format string, args ...any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintf(s.dst, format, args...)
+}
+
+// Step starts capturing a new step. The label names the host or phase the
+// output comes from and is used as the line prefix.
+func (s *Sink) Step(label, name string) *Step {
+	step := &Step{
+		Label:     label,
+		Name:      name,
+		StartedAt: time.Now(),
+		sink:      s,
+	}
+
+	s.mu.Lock()
+	s.steps = append(s.steps, step)
+	s.mu.Unlock()
+
+	return step
+}
+
+// Steps returns every step started so far, in order.
+func (s *Sink) Steps() []*Step {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Step(nil), s.steps...)
+}
+
+// Failed returns the first step that finished with an error, or nil. Later
+// failures, such as of cleanup commands, did not cause the first.
+func (s *Sink) Failed() *Step {
+	for _, step := range s.Steps() {
+		if step.Err != nil {
+			return step
+		}
+	}
+	return nil
+}
+
+func (s *Sink) writeLine(step *Step, at time.Time, line []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Events.Publish(events.OutputLine{Source: step.Label, Command: step.Name, Line: string(line)})
+
+	var buf bytes.Buffer
+	buf.WriteString(at.Format("15:04:05"))
+	buf.WriteString(" [")
+	buf.WriteString(step.Label)
+	buf.WriteString("] ")
+	buf.Write(line)
+	buf.WriteByte('\n')
+
+	s.dst.Write(buf.Bytes())
+}
+
+// Step is the output of a single command. It is an io.Writer that is safe
+// to use from the stdout and stderr copiers at the same time.
+type Step struct {
+	Label      string
+	Name       string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Err        error
+
+	mu        sync.Mutex
+	sink      *Sink
+	partial   []byte
+	captured  []byte
+	truncated bool
+}
+
+func (st *Step) Write(p []byte) (int, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.capture(p)
+
+	st.partial = append(st.partial, p...)
+	for {
+		i := bytes.IndexByte(st.partial, '\n')
+		if i < 0 {
+			break
+		}
+		st.sink.writeLine(st, time.Now(), bytes.TrimSuffix(st.partial[:i], []byte("\r")))
+		st.partial = st.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Finish flushes any unterminated line and records the step's outcome.
+func (st *Step) Finish(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if len(st.partial) > 0 {
+		st.sink.writeLine(st, time.Now(), st.partial)
+		st.partial = nil
+	}
+
+	st.FinishedAt = time.Now()
+	st.Err = err
+}
+
+// Output returns the captured output, which holds at most the sink's limit
+// of trailing bytes.
+func (st *Step) Output() string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return string(st.captured)
+}
+
+// Truncated reports whether earlier output was dropped to stay in the limit.
+func (st *Step) Truncated() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	return st.truncated
+}
+
+// Tail returns the last n lines of captured output.
+func (st *Step) Tail(n int) []string {
+	lines := strings.Split(strings.TrimRight(st.Output(), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
+
+func (st *Step) capture(p []byte) {
+	limit := st.sink.limit
+	st.captured = append(st.captured, p...)
+	if limit > 0 && len(st.captured) > limit {
+		st.captured = append([]byte(nil), st.captured[len(st.captured)-limit:]...)
+		st.truncated = true
+	}
+}
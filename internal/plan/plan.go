@@ -0,0 +1,265 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// StepKind says where and how a step runs.
+type StepKind string
+
+const (
+	// StepLocal runs a command on this machine.
+	StepLocal StepKind = "local"
+	// StepRemote runs a command on a remote over SSH.
+	StepRemote StepKind = "remote"
+	// StepSync transfers a local directory to a remote with rsync.
+	StepSync StepKind = "sync"
+	// StepManifest writes the release manifest to a remote.
+	StepManifest StepKind = "manifest"
+	// StepHealthCheck runs a command on a remote and reports whether it
+	// passed.
+	StepHealthCheck StepKind = "health_check"
+)
+
+// Plan is everything a deploy will do, resolved before anything runs.
+// Dry runs render it and real runs execute it, so the two cannot differ.
+type Plan struct {
+	Project string `json:"project"`
+	Remote  string `json:"remote"`
+	// Ref, when set, is built from a fresh checkout of Commit in place of
+	// the project directory.
+	Ref    string  `json:"ref,omitempty"`
+	Commit string  `json:"commit,omitempty"`
+	Phases []Phase `json:"phases"`
+}
+
+// Phase is a named group of steps that run in order.
+type Phase struct {
+	Name string `json:"name"`
+	When When   `json:"when,omitempty"`
+	// After, when set, names a phase that must have started for this one
+	// to run, such as the phase that a cleanup undoes.
+	After string `json:"after,omitempty"`
+	Steps []Step `json:"steps"`
+}
+
+// When says whether a phase runs depending on how the earlier ones went.
+type When string
+
+const (
+	// WhenSucceeded phases run while no earlier phase has failed.
+	WhenSucceeded When = ""
+	// WhenFailed phases run only after an earlier phase has failed.
+	WhenFailed When = "failed"
+	// WhenAlways phases run whatever happened before them.
+	WhenAlways When = "always"
+)
+
+type Step struct {
+	Kind    StepKind `json:"kind"`
+	Command string   `json:"command,omitempty"`
+	Dir     string   `json:"dir,omitempty"`
+	Env     []string `json:"env,omitempty"`
+	Target  *Target  `json:"target,omitempty"`
+	Sync    *Sync    `json:"sync,omitempty"`
+
+	// Container, when set, runs a local step in a container.
+	Container *Container `json:"container,omitempty"`
+	// PTY runs a remote step on a remote terminal, whatever its target says.
+	PTY bool `json:"pty,omitempty"`
+
+	Manifest *Manifest `json:"manifest,omitempty"`
+}
+
+// Container is the image a local step runs in. Runtime is the container
+// CLI, or empty to use whichever is installed.
+type Container struct {
+	Image   string `json:"image"`
+	Runtime string `json:"runtime,omitempty"`
+}
+
+// Target is the remote a step runs against. Env, as KEY=value pairs, is
+// exported to its commands.
+type Target struct {
+	Name string   `json:"name"`
+	Host string   `json:"host"`
+	User string   `json:"user"`
+	Env  []string `json:"env,omitempty"`
+}
+
+func (t Target) String() string {
+	return t.User + "@" + t.Host
+}
+
+// RemoteCommand returns the command a remote step runs, with its target's
+// env exported first.
+func (s Step) RemoteCommand() string {
+	if s.Target == nil {
+		return s.Command
+	}
+	return withEnv(s.Target.Env, s.Command)
+}
+
+// Sync describes an rsync transfer from a local path to a path on the
+// step's target.
+type Sync struct {
+	Source  string   `json:"source"`
+	Dest    string   `json:"dest"`
+	Options []string `json:"options"`
+	Filters []string `json:"filters,omitempty"`
+}
+
+// Manifest describes the release manifest written to the step's target.
+// Its tree hash and time are only known once the step runs.
+type Manifest struct {
+	// Dest is the manifest file on the remote.
+	Dest    string           `json:"dest"`
+	Sources []ManifestSource `json:"sources"`
+
+	Project string `json:"project"`
+	Commit  string `json:"commit,omitempty"`
+	Ref     string `json:"ref,omitempty"`
+}
+
+// ManifestSource is a synced file or directory, hashed without the Ignore
+// patterns. Prefix is the path relative to the remote path it is synced to.
+type ManifestSource struct {
+	Source string   `json:"source"`
+	Prefix string   `json:"prefix,omitempty"`
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+// AddPhase appends a phase unless it has no steps.
+func (p *Plan) AddPhase(name string, steps ...Step) {
+	p.AddPhaseWhen(name, WhenSucceeded, steps...)
+}
+
+// AddPhaseWhen appends a phase that runs under the given condition unless
+// it has no steps.
+func (p *Plan) AddPhaseWhen(name string, when When, steps ...Step) {
+	if len(steps) == 0 {
+		return
+	}
+	p.Phases = append(p.Phases, Phase{Name: name, When: when, Steps: steps})
+}
+
+// AddCleanupPhase appends a phase that runs, even after a failure, once
+// the phase named after has started.
+func (p *Plan) AddCleanupPhase(name, after string, steps ...Step) {
+	if len(steps) == 0 {
+		return
+	}
+	p.Phases = append(p.Phases, Phase{Name: name, When: WhenAlways, After: after, Steps: steps})
+}
+
+// RemovePhases drops the named phases from the plan.
+func (p *Plan) RemovePhases(names ...string) {
+	p.Phases = slices.DeleteFunc(p.Phases, func(phase Phase) bool {
+		return slices.Contains(names, phase.Name)
+	})
+}
+
+// PhaseNames returns the names of the phases in order.
+func (p *Plan) PhaseNames() []string {
+	names := make([]string, 0, len(p.Phases))
+	for _, phase := range p.Phases {
+		names = append(names, phase.Name)
+	}
+	return names
+}
+
+// LocalSteps returns a local step for each command.
+func LocalSteps(commands []string, dir string, env []string) []Step {
+	steps := make([]Step, 0, len(commands))
+	for _, command := range commands {
+		steps = append(steps, Step{Kind: StepLocal, Command: command, Dir: dir, Env: env})
+	}
+	return steps
+}
+
+// ContainerSteps returns a local step for each command, run in container.
+func ContainerSteps(commands []string, dir string, env []string, container Container) []Step {
+	steps := LocalSteps(commands, dir, env)
+	for i := range steps {
+		steps[i].Container = &container
+	}
+	return steps
+}
+
+// RemoteSteps returns a remote step on target for each command.
+func RemoteSteps(commands []string, target Target) []Step {
+	steps := make([]Step, 0, len(commands))
+	for _, command := range commands {
+		steps = append(steps, Step{Kind: StepRemote, Command: command, Target: &target})
+	}
+	return steps
+}
+
+// HealthCheckSteps returns a health check step on target for each command.
+func HealthCheckSteps(commands []string, target Target) []Step {
+	steps := make([]Step, 0, len(commands))
+	for _, command := range commands {
+		steps = append(steps, Step{Kind: StepHealthCheck, Command: command, Target: &target})
+	}
+	return steps
+}
+
+// WriteText writes the plan for people to read.
+func (p *Plan) WriteText(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Plan: deploy %s to %s\n", p.Project, p.Remote)
+	if p.Ref != "" {
+		fmt.Fprintf(&b, "Builds %s (%s) in a fresh checkout of the project directory\n", p.Ref, p.Commit)
+	}
+	for i, phase := range p.Phases {
+		fmt.Fprintf(&b, "\n%d. %s", i+1, phase.Name)
+		switch {
+		case phase.When == WhenFailed:
+			b.WriteString(" (only after a failure)")
+		case phase.After != "":
+			fmt.Fprintf(&b, " (once %s has started, even after a failure)", phase.After)
+		case phase.When == WhenAlways:
+			b.WriteString(" (even after a failure)")
+		}
+		b.WriteString("\n")
+		for _, step := range phase.Steps {
+			writeStep(&b, step)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeStep(b *strings.Builder, step Step) {
+	switch step.Kind {
+	case StepLocal:
+		fmt.Fprintf(b, "   [local] %s\n", step.Command)
+		fmt.Fprintf(b, "           in %s\n", step.Dir)
+		if step.Container != nil {
+			fmt.Fprintf(b, "           image %s\n", step.Container.Image)
+		}
+		if len(step.Env) > 0 {
+			fmt.Fprintf(b, "           env %s\n", strings.Join(step.Env, " "))
+		}
+	case StepRemote:
+		fmt.Fprintf(b, "   [%s] %s\n", step.Target, step.RemoteCommand())
+		if step.PTY {
+			b.WriteString("           on a terminal\n")
+		}
+	case StepSync:
+		fmt.Fprintf(b, "   [rsync] %s -> %s:%s\n", step.Sync.Source, step.Target, step.Sync.Dest)
+		fmt.Fprintf(b, "           options %s\n", strings.Join(step.Sync.Options, " "))
+		for _, filter := range step.Sync.Filters {
+			fmt.Fprintf(b, "           filter %s\n", filter)
+		}
+	case StepManifest:
+		fmt.Fprintf(b, "   [%s] write manifest %s\n", step.Target, step.Manifest.Dest)
+	case StepHealthCheck:
+		fmt.Fprintf(b, "   [%s] check %s\n", step.Target, step.RemoteCommand())
+	}
+}
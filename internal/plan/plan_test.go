@@ -0,0 +1,29 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteTextRemoteCommand(t *testing.T) {
+	target := Target{Name: "prod", Host: "example.com", User: "deploy", Env: []string{"APP_ENV=prod it", "EMPTY="}}
+	p := &Plan{Project: "web", Remote: "prod", Ref: "v1.2.0", Commit: "366110b"}
+	p.AddPhase("remote_post", RemoteSteps([]string{"systemctl reload nginx"}, target)...)
+
+	var b strings.Builder
+	if err := p.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The plan shows what the runner executes
+	step := p.Phases[0].Steps[0]
+	want := "export APP_ENV='prod it' EMPTY=''; systemctl reload nginx"
+	if got := step.RemoteCommand(); got != want {
+		t.Errorf("RemoteCommand() = %q, want %q", got, want)
+	}
+	for _, line := range []string{"Builds v1.2.0 (366110b) in a fresh checkout", "   [deploy@example.com] " + want + "\n"} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("plan does not contain %q:\n%s", line, b.String())
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"deeployer/internal/events"
+	"deeployer/internal/executor"
+	"deeployer/internal/ignore"
+	"deeployer/internal/manifest"
+	"deeployer/internal/rsync"
+	"deeployer/internal/ssh"
+)
+
+// Runner executes plans with the clients that do the actual work.
+type Runner struct {
+	Executor *executor.Executor
+	Rsync    *rsync.Client
+	SSH      *ssh.Client
+	Verbose  bool
+	Events   *events.Bus
+
+	// Targets holds the SSH settings of every remote, by name.
+	Targets map[string]ssh.Target
+
+	// Containers holds the runner of every container that steps run in,
+	// as returned by ResolveContainers.
+	Containers map[Container]executor.Runner
+
+	// OnSync, when set, receives the statistics of each finished sync.
+	OnSync func(rsync.Stats)
+
+	// Interrupt, when closed, stops the deploy before its next step. The
+	// phases that run after a failure still run.
+	Interrupt <-chan struct{}
+}
+
+// ErrInterrupted is the error of a deploy stopped through Runner.Interrupt.
+var ErrInterrupted = errors.New("interrupted")
+
+// Status is the outcome of a phase.
+type Status string
+
+const (
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Skipped   Status = "skipped"
+)
+
+// PhaseResult records how a phase went and how long it took.
+type PhaseResult struct {
+	Name     string
+	Status   Status
+	Duration time.Duration
+	Err      error
+}
+
+// Run executes the phases in order. After a failure, only the phases meant
+// for it, and those that always run, are executed; the others are reported
+// as skipped.
+//
+// A failing step stops its phase, except in phases that run after failures:
+// those are cleanups, so all of their steps run. The error joins every
+// failure in the order they happened, so the one that failed the deploy
+// comes first and is never hidden by a failing cleanup.
+func (r *Runner) Run(p *Plan) ([]PhaseResult, error) {
+	results := make([]PhaseResult, 0, len(p.Phases))
+
+	var errs []error
+	started := make(map[string]bool)
+	for _, phase := range p.Phases {
+		var skip bool
+		switch phase.When {
+		case WhenSucceeded:
+			skip = len(errs) > 0
+		case WhenFailed:
+			skip = len(errs) == 0
+		}
+		if phase.After != "" && !started[phase.After] {
+			skip = true
+		}
+
+		if skip {
+			results = append(results, PhaseResult{Name: phase.Name, Status: Skipped})
+			r.Events.Publish(events.PhaseFinished{Phase: phase.Name, Status: string(Skipped)})
+			continue
+		}
+
+		if r.Verbose {
+			r.Executor.Output.Printf("Running phase: %s\n", phase.Name)
+		}
+		r.Events.Publish(events.PhaseStarted{Phase: phase.Name})
+		started[phase.Name] = true
+
+		result := PhaseResult{Name: phase.Name, Status: Succeeded}
+		phaseStarted := time.Now()
+		for _, step := range phase.Steps {
+			err := r.interrupted()
+			// Cleanups run even when interrupted
+			if err == nil || phase.When != WhenSucceeded {
+				err = r.runStep(step)
+			}
+			if err == nil {
+				continue
+			}
+
+			result.Status = Failed
+			result.Err = errors.Join(result.Err, err)
+			errs = append(errs, fmt.Errorf("%s: %w", phase.Name, err))
+			if phase.When == WhenSucceeded {
+				break
+			}
+		}
+		result.Duration = time.Since(phaseStarted)
+
+		finished := events.PhaseFinished{
+			Phase:      phase.Name,
+			Status:     string(result.Status),
+			DurationMS: result.Duration.Milliseconds(),
+		}
+		if result.Err != nil {
+			finished.Error = result.Err.Error()
+		}
+		r.Events.Publish(finished)
+
+		results = append(results, result)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func (r *Runner) interrupted() error {
+	select {
+	case <-r.Interrupt:
+		return ErrInterrupted
+	default:
+		return nil
+	}
+}
+
+func (r *Runner) runStep(step Step) error {
+	switch step.Kind {
+	case StepLocal:
+		exec := r.Executor
+		if step.Container != nil {
+			container, ok := r.Containers[*step.Container]
+			if !ok {
+				return fmt.Errorf("container runtime not resolved for image %s", step.Container.Image)
+			}
+			exec = exec.With(container)
+		}
+		return exec.Run(step.Command, step.Dir, step.Env)
+
+	case StepRemote:
+		target, err := r.target(step)
+		if err != nil {
+			return err
+		}
+		if step.PTY {
+			target.PTY = true
+		}
+		return r.SSH.Run(target, step.RemoteCommand())
+
+	case StepHealthCheck:
+		target, err := r.target(step)
+		if err != nil {
+			return err
+		}
+
+		started := time.Now()
+		err = r.SSH.Run(target, step.RemoteCommand())
+		check := events.HealthCheck{
+			Remote:     step.Target.Name,
+			Check:      step.Command,
+			OK:         err == nil,
+			DurationMS: time.Since(started).Milliseconds(),
+		}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		r.Events.Publish(check)
+
+		if err != nil {
+			return fmt.Errorf("health check failed on %s: %w", step.Target.Name, err)
+		}
+		return nil
+
+	case StepSync:
+		target, err := r.target(step)
+		if err != nil {
+			return err
+		}
+
+		if err := r.Executor.CheckOutputDir(step.Sync.Source); err != nil {
+			return err
+		}
+
+		// rsync uses the system ssh, which needs the host key in known_hosts
+		if err := r.SSH.EnsureHostKey(target); err != nil {
+			return fmt.Errorf("host key verification failed for %s: %w", step.Target.Name, err)
+		}
+
+		stats, err := r.Rsync.Sync(step.Sync.Source, target.User, target.Host, step.Sync.Dest, step.Sync.Options, step.Sync.Filters)
+		if err != nil {
+			return fmt.Errorf("rsync to %s failed: %w", step.Target.Name, err)
+		}
+
+		if r.OnSync != nil {
+			r.OnSync(stats)
+		}
+		return nil
+
+	case StepManifest:
+		target, err := r.target(step)
+		if err != nil {
+			return err
+		}
+
+		sources := make([]manifest.Source, 0, len(step.Manifest.Sources))
+		for _, source := range step.Manifest.Sources {
+			rules := &ignore.Rules{}
+			for _, pattern := range source.Ignore {
+				rules.Add(pattern)
+			}
+			sources = append(sources, manifest.Source{Root: source.Source, Prefix: source.Prefix, Rules: rules})
+		}
+		tree, err := manifest.HashSources(sources)
+		if err != nil {
+			return err
+		}
+
+		data, err := manifest.New(step.Manifest.Project, step.Target.Name, step.Manifest.Commit, step.Manifest.Ref, tree).Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to encode manifest: %w", err)
+		}
+		return r.SSH.WriteFile(target, step.Manifest.Dest, data)
+
+	default:
+		return fmt.Errorf("unknown step kind: %s", step.Kind)
+	}
+}
+
+// ResolveContainers finds the container runtime of every container the
+// plan's steps run in, once for each, before anything runs.
+func ResolveContainers(p *Plan) (map[Container]executor.Runner, error) {
+	containers := make(map[Container]executor.Runner)
+	for _, phase := range p.Phases {
+		for _, step := range phase.Steps {
+			if step.Container == nil {
+				continue
+			}
+			if _, ok := containers[*step.Container]; ok {
+				continue
+			}
+
+			container, err := executor.NewContainer(step.Container.Runtime, step.Container.Image)
+			if err != nil {
+				return nil, err
+			}
+			containers[*step.Container] = container
+		}
+	}
+	return containers, nil
+}
+
+func (r *Runner) target(step Step) (ssh.Target, error) {
+	if step.Target == nil {
+		return ssh.Target{}, fmt.Errorf("%s step has no target", step.Kind)
+	}
+
+	target, ok := r.Targets[step.Target.Name]
+	if !ok {
+		return ssh.Target{}, fmt.Errorf("unknown remote: %s", step.Target.Name)
+	}
+
+	return target, nil
+}
+
+// withEnv prefixes command with exports of env, given as KEY=value pairs.
+func withEnv(env []string, command string) string {
+	if len(env) == 0 {
+		return command
+	}
+
+	var b strings.Builder
+	b.WriteString("export")
+	for _, pair := range env {
+		name, value, _ := strings.Cut(pair, "=")
+		fmt.Fprintf(&b, " %s=%s", name, ssh.Quote(value))
+	}
+	return b.String() + "; " + command
+}
@@ -0,0 +1,229 @@
+package plan
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"deeployer/internal/executor"
+	"deeployer/internal/output"
+)
+
+// stubRunner records the commands it is asked to run and runs true in their
+// place, or false for those starting with "fail". A command starting with
+// "interrupt" closes interrupt, as a Ctrl-C during it would.
+type stubRunner struct {
+	ran       []string
+	interrupt chan struct{}
+}
+
+func (s *stubRunner) Command(parts []string, workDir string, env []string) *exec.Cmd {
+	command := strings.Join(parts, " ")
+	s.ran = append(s.ran, command)
+
+	if strings.HasPrefix(command, "interrupt") {
+		close(s.interrupt)
+	}
+	if strings.HasPrefix(command, "fail") {
+		return exec.Command("false")
+	}
+	return exec.Command("true")
+}
+
+func TestRunnerRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		plan       func(p *Plan)
+		wantRan    []string
+		wantStatus map[string]Status
+		// wantErrs are the phase prefixes of the joined errors, in order
+		wantErrs []string
+	}{
+		{
+			name: "success",
+			plan: func(p *Plan) {
+				p.AddPhase("build", LocalSteps([]string{"build"}, "", nil)...)
+				p.AddPhaseWhen("local_post", WhenAlways, LocalSteps([]string{"local_post"}, "", nil)...)
+				p.AddPhase("on_success", LocalSteps([]string{"on_success"}, "", nil)...)
+				p.AddPhaseWhen("on_failure", WhenFailed, LocalSteps([]string{"on_failure"}, "", nil)...)
+			},
+			wantRan:    []string{"build", "local_post", "on_success"},
+			wantStatus: map[string]Status{"build": Succeeded, "local_post": Succeeded, "on_success": Succeeded, "on_failure": Skipped},
+		},
+		{
+			name: "failed build",
+			plan: func(p *Plan) {
+				p.AddPhase("build", LocalSteps([]string{"fail build", "never"}, "", nil)...)
+				p.AddPhase("sync", LocalSteps([]string{"sync"}, "", nil)...)
+				p.AddPhaseWhen("local_post", WhenAlways, LocalSteps([]string{"local_post"}, "", nil)...)
+				p.AddPhase("on_success", LocalSteps([]string{"on_success"}, "", nil)...)
+				p.AddPhaseWhen("on_failure", WhenFailed, LocalSteps([]string{"fail on_failure"}, "", nil)...)
+			},
+			wantRan: []string{"fail build", "local_post", "fail on_failure"},
+			wantStatus: map[string]Status{
+				"build": Failed, "sync": Skipped, "local_post": Succeeded, "on_success": Skipped, "on_failure": Failed,
+			},
+			wantErrs: []string{"build: ", "on_failure: "},
+		},
+		{
+			name: "failing cleanup step",
+			plan: func(p *Plan) {
+				p.AddPhase("maintenance_on", LocalSteps([]string{"maintenance_on"}, "", nil)...)
+				p.AddPhase("sync", LocalSteps([]string{"fail sync"}, "", nil)...)
+				p.AddCleanupPhase("maintenance_off", "maintenance_on", LocalSteps([]string{"fail maintenance_off", "restart"}, "", nil)...)
+			},
+			wantRan:    []string{"maintenance_on", "fail sync", "fail maintenance_off", "restart"},
+			wantStatus: map[string]Status{"maintenance_on": Succeeded, "sync": Failed, "maintenance_off": Failed},
+			wantErrs:   []string{"sync: ", "maintenance_off: "},
+		},
+		{
+			name: "cleanup of a phase that never started",
+			plan: func(p *Plan) {
+				p.AddPhase("build", LocalSteps([]string{"fail build"}, "", nil)...)
+				p.AddPhase("maintenance_on", LocalSteps([]string{"maintenance_on"}, "", nil)...)
+				p.AddCleanupPhase("maintenance_off", "maintenance_on", LocalSteps([]string{"maintenance_off"}, "", nil)...)
+			},
+			wantRan:    []string{"fail build"},
+			wantStatus: map[string]Status{"build": Failed, "maintenance_on": Skipped, "maintenance_off": Skipped},
+			wantErrs:   []string{"build: "},
+		},
+		{
+			name: "interrupted",
+			plan: func(p *Plan) {
+				p.AddPhase("maintenance_on", LocalSteps([]string{"maintenance_on"}, "", nil)...)
+				p.AddPhase("sync", LocalSteps([]string{"interrupt sync", "never"}, "", nil)...)
+				p.AddPhase("remote_post", LocalSteps([]string{"never"}, "", nil)...)
+				p.AddCleanupPhase("maintenance_off", "maintenance_on", LocalSteps([]string{"maintenance_off", "restart"}, "", nil)...)
+				p.AddPhaseWhen("local_post", WhenAlways, LocalSteps([]string{"local_post"}, "", nil)...)
+				p.AddPhaseWhen("on_failure", WhenFailed, LocalSteps([]string{"on_failure"}, "", nil)...)
+			},
+			wantRan: []string{"maintenance_on", "interrupt sync", "maintenance_off", "restart", "local_post", "on_failure"},
+			wantStatus: map[string]Status{
+				"maintenance_on": Succeeded, "sync": Failed, "remote_post": Skipped,
+				"maintenance_off": Succeeded, "local_post": Succeeded, "on_failure": Succeeded,
+			},
+			wantErrs: []string{"sync: "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &stubRunner{interrupt: make(chan struct{})}
+			e := &executor.Executor{Output: output.NewSink(io.Discard, output.DefaultLimit)}
+			r := &Runner{Executor: e.With(stub), Interrupt: stub.interrupt}
+
+			p := &Plan{}
+			tt.plan(p)
+			results, err := r.Run(p)
+
+			if !slices.Equal(stub.ran, tt.wantRan) {
+				t.Errorf("ran %q, want %q", stub.ran, tt.wantRan)
+			}
+
+			if len(results) != len(p.Phases) {
+				t.Fatalf("got %d results for %d phases", len(results), len(p.Phases))
+			}
+			for _, result := range results {
+				if want := tt.wantStatus[result.Name]; result.Status != want {
+					t.Errorf("phase %s %s, want %s", result.Name, result.Status, want)
+				}
+				if (result.Err != nil) != (result.Status == Failed) {
+					t.Errorf("phase %s %s with error %v", result.Name, result.Status, result.Err)
+				}
+			}
+
+			var errs []error
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				errs = joined.Unwrap()
+			}
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("got errors %v, want %d", err, len(tt.wantErrs))
+			}
+			for i, want := range tt.wantErrs {
+				if !strings.HasPrefix(errs[i].Error(), want) {
+					t.Errorf("error %d is %q, want it from %s", i, errs[i], strings.TrimSuffix(want, ": "))
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerRunInterruptedBeforeStart(t *testing.T) {
+	stub := &stubRunner{interrupt: make(chan struct{})}
+	close(stub.interrupt)
+	e := &executor.Executor{Output: output.NewSink(io.Discard, output.DefaultLimit)}
+	r := &Runner{Executor: e.With(stub), Interrupt: stub.interrupt}
+
+	p := &Plan{}
+	p.AddPhase("build", LocalSteps([]string{"build"}, "", nil)...)
+	p.AddPhaseWhen("always", WhenAlways, LocalSteps([]string{"always"}, "", nil)...)
+	_, err := r.Run(p)
+
+	if !errors.Is(err, ErrInterrupted) {
+		t.Errorf("got %v, want %v", err, ErrInterrupted)
+	}
+	if !slices.Equal(stub.ran, []string{"always"}) {
+		t.Errorf("ran %q, want only the always phase", stub.ran)
+	}
+}
+
+func TestResolveContainers(t *testing.T) {
+	// The runtime logs each --version probe and each run
+	dir := t.TempDir()
+	cli := filepath.Join(dir, "runtime")
+	log := filepath.Join(dir, "calls.log")
+	script := "#!/bin/sh\necho \"$1\" >> '" + log + "'\n" +
+		"if [ \"$1\" = --version ]; then echo 'Docker version 27.3.1'; fi\n"
+	if err := os.WriteFile(cli, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	node := Container{Image: "node:20", Runtime: cli}
+	golang := Container{Image: "golang:1.23", Runtime: cli}
+	p := &Plan{}
+	p.AddPhase("build", slices.Concat(
+		ContainerSteps([]string{"npm ci", "npm run build"}, dir, nil, node),
+		ContainerSteps([]string{"go build"}, dir, nil, golang),
+		LocalSteps([]string{"true"}, dir, nil),
+	)...)
+	p.AddPhase("post_build", ContainerSteps([]string{"npm test"}, dir, nil, node)...)
+
+	containers, err := ResolveContainers(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 {
+		t.Errorf("resolved %d containers, want 2", len(containers))
+	}
+
+	r := &Runner{
+		Executor:   &executor.Executor{Output: output.NewSink(io.Discard, output.DefaultLimit)},
+		Containers: containers,
+	}
+	if _, err := r.Run(p); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"--version", "--version", "run", "run", "run", "run"}
+	if got := strings.Fields(string(data)); !slices.Equal(got, want) {
+		t.Errorf("runtime calls %q, want %q", got, want)
+	}
+}
+
+func TestResolveContainersMissingRuntime(t *testing.T) {
+	p := &Plan{}
+	p.AddPhase("build", ContainerSteps([]string{"make"}, "", nil, Container{Image: "node:20", Runtime: filepath.Join(t.TempDir(), "missing")})...)
+
+	if _, err := ResolveContainers(p); err == nil {
+		t.Error("a missing runtime was resolved")
+	}
+}
@@ -0,0 +1,97 @@
+package rsync
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind classifies a file that differs between local and remote.
+type ChangeKind string
+
+const (
+	ChangeNew      ChangeKind = "new"
+	ChangeModified ChangeKind = "modified"
+	ChangeDeleted  ChangeKind = "deleted"
+)
+
+// Change is a file that a sync would create, update or delete.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	Path string     `json:"path"`
+	Size int64      `json:"size"`
+}
+
+var (
+	// Lines printed with --out-format="%i %l %n"
+	changeLine  = regexp.MustCompile(`^([<>ch.])([fdLDS])(\S{9,10}) (\d+) (.+)$`)
+	deletedLine = regexp.MustCompile(`^\*deleting\s+(\d+) (.+)$`)
+)
+
+// Changes runs rsync with --dry-run and reports the files a sync with the
+// same arguments would change. With checksum set, files are compared by
+// content instead of size and modification time.
+func (c *Client) Changes(localPath, remoteUser, remoteHost, remotePath string, options, filters []string, checksum bool) ([]Change, error) {
+	if err := c.validatePaths(localPath); err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, len(options)+len(filters)+6)
+	args = append(args, options...)
+	for _, filter := range filters {
+		args = append(args, "--filter="+filter)
+	}
+	args = append(args, "--dry-run", "--itemize-changes", "--out-format=%i %l %n")
+	if checksum {
+		args = append(args, "--checksum")
+	}
+	args = append(args, c.ensureDirectorySync(localPath), fmt.Sprintf("%s@%s:%s", remoteUser, remoteHost, remotePath))
+
+	if c.Verbose {
+		c.Output.Printf("Executing: rsync %s\n", strings.Join(args, " "))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("rsync", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseChanges(stdout.String()), nil
+}
+
+func parseChanges(out string) []Change {
+	var changes []Change
+	for _, line := range strings.Split(out, "\n") {
+		if m := deletedLine.FindStringSubmatch(line); m != nil {
+			if strings.HasSuffix(m[2], "/") {
+				continue
+			}
+			size, _ := strconv.ParseInt(m[1], 10, 64)
+			changes = append(changes, Change{Kind: ChangeDeleted, Path: m[2], Size: size})
+			continue
+		}
+
+		m := changeLine.FindStringSubmatch(line)
+		// Directories are implied by the files inside them
+		if m == nil || m[2] == "d" {
+			continue
+		}
+
+		size, _ := strconv.ParseInt(m[4], 10, 64)
+		switch {
+		case strings.Trim(m[3], "+") == "":
+			changes = append(changes, Change{Kind: ChangeNew, Path: m[5], Size: size})
+		case m[1] == "<" || m[1] == ">" || m[1] == "c":
+			changes = append(changes, Change{Kind: ChangeModified, Path: m[5], Size: size})
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,83 @@
+package rsync
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want []Change
+	}{
+		{
+			name: "new file",
+			out:  ">f+++++++++ 1204 index.html\n",
+			want: []Change{{Kind: ChangeNew, Path: "index.html", Size: 1204}},
+		},
+		{
+			name: "new directory is implied by its files",
+			out:  "cd+++++++++ 4096 assets/\n>f+++++++++ 512 assets/app.js\n",
+			want: []Change{{Kind: ChangeNew, Path: "assets/app.js", Size: 512}},
+		},
+		{
+			name: "size and time changed",
+			out:  ">f.st...... 2048 app.js\n",
+			want: []Change{{Kind: ChangeModified, Path: "app.js", Size: 2048}},
+		},
+		{
+			name: "checksum changed",
+			out:  ">fc.t...... 10 config.json\n",
+			want: []Change{{Kind: ChangeModified, Path: "config.json", Size: 10}},
+		},
+		{
+			name: "local change",
+			out:  "cL+++++++++ 0 current\n",
+			want: []Change{{Kind: ChangeNew, Path: "current", Size: 0}},
+		},
+		{
+			name: "attributes only",
+			out:  ".f...p..... 100 run.sh\n.d..t...... 4096 assets/\n",
+		},
+		{
+			name: "deleted file",
+			out:  "*deleting   0 old.css\n",
+			want: []Change{{Kind: ChangeDeleted, Path: "old.css", Size: 0}},
+		},
+		{
+			name: "deleted directory is implied by its files",
+			out:  "*deleting   0 old/a.txt\n*deleting   0 old/\n",
+			want: []Change{{Kind: ChangeDeleted, Path: "old/a.txt", Size: 0}},
+		},
+		{
+			name: "path with spaces",
+			out:  ">f+++++++++ 7 docs/read me.txt\n",
+			want: []Change{{Kind: ChangeNew, Path: "docs/read me.txt", Size: 7}},
+		},
+		{
+			name: "other lines are ignored",
+			out:  "sending incremental file list\n\nsent 120 bytes  received 12 bytes\n",
+		},
+		{
+			name: "mixed",
+			out: "*deleting   0 stale.js\n" +
+				"cd+++++++++ 4096 img/\n" +
+				">f+++++++++ 300 img/logo.png\n" +
+				">f.st...... 900 index.html\n",
+			want: []Change{
+				{Kind: ChangeDeleted, Path: "stale.js", Size: 0},
+				{Kind: ChangeNew, Path: "img/logo.png", Size: 300},
+				{Kind: ChangeModified, Path: "index.html", Size: 900},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseChanges(tt.out); !slices.Equal(got, tt.want) {
+				t.Errorf("parseChanges(%q)\ngot  %+v\nwant %+v", tt.out, got, tt.want)
+			}
+		})
+	}
+}
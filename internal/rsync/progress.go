@@ -0,0 +1,258 @@
+package rsync
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Stats summarizes a finished transfer. Created, Updated and Deleted count
+// files, as the changes listed by Changes do, not directories.
+type Stats struct {
+	Created          int   `json:"created"`
+	Updated          int   `json:"updated"`
+	Deleted          int   `json:"deleted"`
+	FilesTransferred int   `json:"files_transferred"`
+	TotalSize        int64 `json:"total_size"`
+	TransferredSize  int64 `json:"transferred_size"`
+	BytesSent        int64 `json:"bytes_sent"`
+	BytesReceived    int64 `json:"bytes_received"`
+}
+
+// Add adds the statistics of another transfer.
+func (s *Stats) Add(other Stats) {
+	s.Created += other.Created
+	s.Updated += other.Updated
+	s.Deleted += other.Deleted
+	s.FilesTransferred += other.FilesTransferred
+	s.TotalSize += other.TotalSize
+	s.TransferredSize += other.TransferredSize
+	s.BytesSent += other.BytesSent
+	s.BytesReceived += other.BytesReceived
+}
+
+// Progress is a snapshot of an rsync --info=progress2 line.
+type Progress struct {
+	Bytes   int64
+	Percent int
+	Rate    string
+	ETA     string
+}
+
+var (
+	// "    1,234,567  45%   12.34MB/s    0:00:03 (xfr#5, to-chk=10/20)"
+	progressLine = regexp.MustCompile(`^\s*([\d,]+)\s+(\d+)%\s+(\S+/s)\s+(\d+:\d{2}:\d{2})`)
+	// ">f+++++++++ path", "cd+++++++++ dir/", ".f..t...... path"
+	itemizeLine  = regexp.MustCompile(`^([<>ch.])([fdLDS])(\S{9,10}) (.+)$`)
+	deletingLine = regexp.MustCompile(`^\*deleting\s+(.+)$`)
+	statsLine    = regexp.MustCompile(`^(Number of regular files transferred|Total file size|Total transferred file size|Total bytes sent|Total bytes received): ([\d,]+)`)
+	// Remaining lines of the --stats block, replaced by the summary
+	summaryLine = regexp.MustCompile(`^(Number of |Literal data|Matched data|File list |sent [\d,.]+\S* bytes|total size is )`)
+)
+
+// outputParser consumes rsync's stdout, collecting statistics and progress
+// while forwarding the lines a user should see.
+type outputParser struct {
+	forward    io.Writer
+	verbose    bool
+	onProgress func(Progress)
+
+	mu      sync.Mutex
+	partial []byte
+	stats   Stats
+}
+
+func (p *outputParser) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.partial = append(p.partial, b...)
+	for {
+		// Progress updates are terminated by \r, everything else by \n
+		i := bytes.IndexAny(p.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		p.parseLine(string(p.partial[:i]))
+		p.partial = p.partial[i+1:]
+	}
+
+	return len(b), nil
+}
+
+// Close parses an unterminated final line.
+func (p *outputParser) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.partial) > 0 {
+		p.parseLine(string(p.partial))
+		p.partial = nil
+	}
+	return nil
+}
+
+func (p *outputParser) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.stats
+}
+
+func (p *outputParser) parseLine(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	if m := progressLine.FindStringSubmatch(line); m != nil {
+		if p.onProgress != nil {
+			percent, _ := strconv.Atoi(m[2])
+			p.onProgress(Progress{
+				Bytes:   parseNumber(m[1]),
+				Percent: percent,
+				Rate:    m[3],
+				ETA:     m[4],
+			})
+		}
+		return
+	}
+
+	if m := deletingLine.FindStringSubmatch(line); m != nil {
+		if !strings.HasSuffix(m[1], "/") {
+			p.stats.Deleted++
+		}
+		p.forwardVerbose(line)
+		return
+	}
+
+	if m := itemizeLine.FindStringSubmatch(line); m != nil {
+		p.countItem(m[1], m[2], m[3])
+		p.forwardVerbose(line)
+		return
+	}
+
+	if m := statsLine.FindStringSubmatch(line); m != nil {
+		p.parseStat(m[1], parseNumber(m[2]))
+		p.forwardVerbose(line)
+		return
+	}
+
+	if summaryLine.MatchString(line) {
+		p.forwardVerbose(line)
+		return
+	}
+
+	fmt.Fprintln(p.forward, line)
+}
+
+func (p *outputParser) countItem(update, fileType, attrs string) {
+	// Directories are implied by the files inside them, and their times
+	// change whenever their contents do
+	if fileType == "d" {
+		return
+	}
+
+	switch {
+	case strings.Trim(attrs, "+") == "":
+		p.stats.Created++
+	case update == "<" || update == ">" || update == "c":
+		p.stats.Updated++
+	case strings.Trim(attrs, ". ") != "":
+		// Attribute-only changes count as updates
+		p.stats.Updated++
+	}
+}
+
+func (p *outputParser) parseStat(name string, value int64) {
+	switch name {
+	case "Number of regular files transferred":
+		p.stats.FilesTransferred = int(value)
+	case "Total file size":
+		p.stats.TotalSize = value
+	case "Total transferred file size":
+		p.stats.TransferredSize = value
+	case "Total bytes sent":
+		p.stats.BytesSent = value
+	case "Total bytes received":
+		p.stats.BytesReceived = value
+	}
+}
+
+func (p *outputParser) forwardVerbose(line string) {
+	if p.verbose {
+		fmt.Fprintln(p.forward, line)
+	}
+}
+
+func parseNumber(s string) int64 {
+	n, _ := strconv.ParseInt(strings.ReplaceAll(s, ",", ""), 10, 64)
+	return n
+}
+
+// progressBar redraws a single terminal line with the transfer progress.
+type progressBar struct {
+	w        io.Writer
+	bar      progress.Model
+	style    lipgloss.Style
+	mu       sync.Mutex
+	lastDraw time.Time
+	drawn    bool
+}
+
+func newProgressBar(w io.Writer) *progressBar {
+	return &progressBar{
+		w:     w,
+		bar:   progress.New(progress.WithDefaultGradient(), progress.WithWidth(30)),
+		style: lipgloss.NewStyle().Faint(true),
+	}
+}
+
+func (b *progressBar) Update(p Progress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Redrawing more often than this only makes the terminal flicker
+	if time.Since(b.lastDraw) < 100*time.Millisecond && p.Percent < 100 {
+		return
+	}
+	b.lastDraw = time.Now()
+	b.drawn = true
+
+	details := fmt.Sprintf("%s  %s  ETA %s", FormatBytes(p.Bytes), p.Rate, p.ETA)
+	fmt.Fprintf(b.w, "\r\033[K%s %s", b.bar.ViewAs(float64(p.Percent)/100), b.style.Render(details))
+}
+
+// Clear removes the bar so that following output starts on a clean line.
+func (b *progressBar) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.drawn {
+		fmt.Fprint(b.w, "\r\033[K")
+		b.drawn = false
+	}
+}
+
+// FormatBytes renders a byte count with a binary unit, such as "1.2 MiB".
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
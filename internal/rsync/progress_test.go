@@ -0,0 +1,131 @@
+package rsync
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOutputParser(t *testing.T) {
+	tests := []struct {
+		name string
+		// chunks are written one at a time, as rsync's pipe delivers them
+		chunks       []string
+		verbose      bool
+		wantStats    Stats
+		wantForward  string
+		wantProgress []Progress
+	}{
+		{
+			name:      "new file and directory",
+			chunks:    []string{"cd+++++++++ assets/\n>f+++++++++ assets/app.js\n"},
+			wantStats: Stats{Created: 1},
+		},
+		{
+			name:      "updated file",
+			chunks:    []string{">f.st...... index.html\n"},
+			wantStats: Stats{Updated: 1},
+		},
+		{
+			name:      "new link and nested directories",
+			chunks:    []string{"cd+++++++++ a/\ncd+++++++++ a/b/\ncL+++++++++ a/b/current -> v2\n"},
+			wantStats: Stats{Created: 1},
+		},
+		{
+			name:      "attribute changes count for files only",
+			chunks:    []string{".f...p..... run.sh\n.d..t...... assets/\n"},
+			wantStats: Stats{Updated: 1},
+		},
+		{
+			name:      "deletions count files only",
+			chunks:    []string{"*deleting   old/app.css\n*deleting   old.css\n*deleting   old/\n"},
+			wantStats: Stats{Deleted: 2},
+		},
+		{
+			name:        "itemized lines are forwarded when verbose",
+			chunks:      []string{">f+++++++++ a.txt\n*deleting   b.txt\n"},
+			verbose:     true,
+			wantStats:   Stats{Created: 1, Deleted: 1},
+			wantForward: ">f+++++++++ a.txt\n*deleting   b.txt\n",
+		},
+		{
+			name: "stats block",
+			chunks: []string{
+				"Number of files: 12 (reg: 10, dir: 2)\n",
+				"Number of regular files transferred: 3\n",
+				"Total file size: 1,234,567 bytes\n",
+				"Total transferred file size: 45,678 bytes\n",
+				"Literal data: 45,678 bytes\n",
+				"Total bytes sent: 46,001\n",
+				"Total bytes received: 120\n",
+				"sent 46,001 bytes  received 120 bytes  92,242.00 bytes/sec\n",
+				"total size is 1,234,567  speedup is 26.77\n",
+			},
+			wantStats: Stats{
+				FilesTransferred: 3,
+				TotalSize:        1234567,
+				TransferredSize:  45678,
+				BytesSent:        46001,
+				BytesReceived:    120,
+			},
+		},
+		{
+			name:        "other lines are always forwarded",
+			chunks:      []string{"rsync: warning: some files vanished\n"},
+			wantForward: "rsync: warning: some files vanished\n",
+		},
+		{
+			name:   "progress lines end with a carriage return",
+			chunks: []string{"      1,234,567  45%   12.34MB/s    0:00:03 (xfr#5, to-chk=10/20)\r        2,000,000 100%   11.00MB/s    0:00:00 (xfr#6, to-chk=0/20)\r"},
+			wantProgress: []Progress{
+				{Bytes: 1234567, Percent: 45, Rate: "12.34MB/s", ETA: "0:00:03"},
+				{Bytes: 2000000, Percent: 100, Rate: "11.00MB/s", ETA: "0:00:00"},
+			},
+		},
+		{
+			name:         "partial progress line",
+			chunks:       []string{"     32,768   1", "0%    1.00MB/s    0:00", ":09\r"},
+			wantProgress: []Progress{{Bytes: 32768, Percent: 10, Rate: "1.00MB/s", ETA: "0:00:09"}},
+		},
+		{
+			name:      "partial itemize line",
+			chunks:    []string{">f+++", "++++++ a.txt\n>f.st", "...... b.txt\n"},
+			wantStats: Stats{Created: 1, Updated: 1},
+		},
+		{
+			name:        "unterminated last line is parsed on close",
+			chunks:      []string{"*deleting   a.txt\nrsync error: some files could not be transferred"},
+			wantStats:   Stats{Deleted: 1},
+			wantForward: "rsync error: some files could not be transferred\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forward strings.Builder
+			var progress []Progress
+			p := &outputParser{
+				forward:    &forward,
+				verbose:    tt.verbose,
+				onProgress: func(pr Progress) { progress = append(progress, pr) },
+			}
+
+			for _, chunk := range tt.chunks {
+				if _, err := p.Write([]byte(chunk)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			p.Close()
+
+			if got := p.Stats(); got != tt.wantStats {
+				t.Errorf("stats\ngot  %+v\nwant %+v", got, tt.wantStats)
+			}
+			if got := forward.String(); got != tt.wantForward {
+				t.Errorf("forwarded %q, want %q", got, tt.wantForward)
+			}
+			if !slices.Equal(progress, tt.wantProgress) {
+				t.Errorf("progress\ngot  %+v\nwant %+v", progress, tt.wantProgress)
+			}
+		})
+	}
+}
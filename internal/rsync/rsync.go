@@ -1,52 +1,158 @@
 package rsync
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+
+	"deeployer/internal/events"
+	"deeployer/internal/output"
+
+	"golang.org/x/term"
 )
 
 type Client struct {
 	DryRun  bool
 	Verbose bool
+	Output  *output.Sink
+	Events  *events.Bus
+
+	// HideProgress turns off the progress bar drawn on a terminal, for
+	// callers that show progress themselves.
+	HideProgress bool
+
+	// version is the local rsync's major and minor version, detected by
+	// CheckRsyncAvailable.
+	version [2]int
 }
 
+var versionLine = regexp.MustCompile(`version (\d+)\.(\d+)`)
+
 func New(dryRun, verbose bool) *Client {
 	return &Client{
 		DryRun:  dryRun,
 		Verbose: verbose,
+		Output:  output.NewSink(os.Stdout, output.DefaultLimit),
 	}
 }
 
-func (c *Client) Sync(localPath, remoteUser, remoteHost, remotePath string, options []string) error {
+// Sync transfers localPath to the remote and returns what was changed.
+// Filters are rsync filter rules such as "- *.map", applied in order.
+func (c *Client) Sync(localPath, remoteUser, remoteHost, remotePath string, options, filters []string) (Stats, error) {
 	if err := c.validatePaths(localPath); err != nil {
-		return err
+		return Stats{}, err
 	}
 
-	args := c.buildRsyncArgs(localPath, remoteUser, remoteHost, remotePath, options)
+	args := c.buildRsyncArgs(localPath, remoteUser, remoteHost, remotePath, options, filters)
 
 	if c.Verbose || c.DryRun {
-		fmt.Printf("Executing: rsync %s\n", strings.Join(args, " "))
+		c.Output.Printf("Executing: rsync %s\n", strings.Join(args, " "))
 	}
 
 	if c.DryRun {
-		return nil
+		return Stats{}, nil
+	}
+
+	command := "rsync " + strings.Join(args, " ")
+	step := c.Output.Step("rsync", command)
+	c.Events.Publish(events.CommandStarted{Source: "rsync", Command: command})
+
+	var bar *progressBar
+	if !c.HideProgress && term.IsTerminal(int(os.Stderr.Fd())) {
+		bar = newProgressBar(os.Stderr)
+	}
+
+	parser := &outputParser{
+		forward: writerFunc(func(p []byte) (int, error) {
+			if bar != nil {
+				bar.Clear()
+			}
+			return step.Write(p)
+		}),
+		verbose: c.Verbose,
+	}
+
+	lastPercent := -1
+	parser.onProgress = func(p Progress) {
+		if bar != nil {
+			bar.Update(p)
+		}
+		// One event per percent is plenty for anyone watching the stream
+		if p.Percent != lastPercent {
+			lastPercent = p.Percent
+			c.Events.Publish(events.SyncProgress{Bytes: p.Bytes, Percent: p.Percent, Rate: p.Rate, ETA: p.ETA})
+		}
 	}
 
 	cmd := exec.Command("rsync", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = parser
+	cmd.Stderr = step
+
+	err := cmd.Run()
+	parser.Close()
+	if bar != nil {
+		bar.Clear()
+	}
+	step.Finish(err)
+	c.Events.Publish(events.Exited("rsync", command, step.StartedAt, exitCode(err), err))
 
-	return cmd.Run()
+	return parser.Stats(), err
 }
 
-func (c *Client) buildRsyncArgs(localPath, remoteUser, remoteHost, remotePath string, options []string) []string {
-	args := make([]string, 0, len(options)+3)
+// exitCode returns rsync's exit status, or -1 when it could not be started
+// or was killed by a signal.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// ProtectFilters returns rsync protect rules keeping paths, relative to the
+// remote destination, from being deleted by --delete.
+func ProtectFilters(paths []string) []string {
+	filters := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		filters = append(filters, "P "+p)
+	}
+	return filters
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func (c *Client) buildRsyncArgs(localPath, remoteUser, remoteHost, remotePath string, options, filters []string) []string {
+	args := make([]string, 0, len(options)+len(filters)+5)
 
 	args = append(args, options...)
 
+	for _, filter := range filters {
+		args = append(args, "--filter="+filter)
+	}
+
+	// Itemized changes and stats are parsed into the transfer summary
+	if c.supportsInfo() {
+		args = append(args, "--info=progress2,stats2", "--itemize-changes")
+	} else {
+		args = append(args, "--stats", "--itemize-changes")
+	}
+
 	if c.DryRun {
 		args = append(args, "--dry-run")
 	}
@@ -91,14 +197,26 @@ func (c *Client) ensureDirectorySync(path string) string {
 }
 
 func (c *Client) CheckRsyncAvailable() error {
-	if c.DryRun {
-		return nil
-	}
-
-	_, err := exec.LookPath("rsync")
+	path, err := exec.LookPath("rsync")
 	if err != nil {
+		if c.DryRun {
+			return nil
+		}
 		return fmt.Errorf("rsync not found in PATH: %w", err)
 	}
 
+	out, err := exec.Command(path, "--version").Output()
+	if err == nil {
+		if m := versionLine.FindSubmatch(out); m != nil {
+			c.version[0], _ = strconv.Atoi(string(m[1]))
+			c.version[1], _ = strconv.Atoi(string(m[2]))
+		}
+	}
+
 	return nil
 }
+
+// supportsInfo reports whether rsync understands --info, added in 3.1.0.
+func (c *Client) supportsInfo() bool {
+	return c.version[0] > 3 || (c.version[0] == 3 && c.version[1] >= 1)
+}
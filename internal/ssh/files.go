@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// missingStatus is the exit status of ReadFile's command when the file does
+// not exist.
+const missingStatus = 66
+
+// Quote quotes s as a single word for a POSIX shell.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// WriteFile replaces the file at filePath on the target with data,
+// creating its directory first.
+func (c *Client) WriteFile(target Target, filePath string, data []byte) error {
+	command := fmt.Sprintf("mkdir -p %s && cat > %s", Quote(path.Dir(filePath)), Quote(filePath))
+	if c.DryRun {
+		c.Output.Printf("Would write %d bytes on %s@%s: %s\n", len(data), target.User, target.Host, filePath)
+		return nil
+	}
+
+	client, err := c.client(target)
+	if err != nil {
+		return err
+	}
+
+	if err := c.executeCommand(client, target, command, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write %s on %s@%s: %w", filePath, target.User, target.Host, err)
+	}
+
+	return nil
+}
+
+// ReadFile returns the contents of the file at filePath on the target. The
+// error wraps fs.ErrNotExist when there is no such file.
+func (c *Client) ReadFile(target Target, filePath string) ([]byte, error) {
+	quoted := Quote(filePath)
+	data, err := c.Capture(target, fmt.Sprintf("test -e %s || exit %d; cat %s", quoted, missingStatus, quoted))
+	if exitStatus(err) == missingStatus {
+		return nil, fmt.Errorf("%s on %s@%s: %w", filePath, target.User, target.Host, fs.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s on %s@%s: %w", filePath, target.User, target.Host, err)
+	}
+
+	return data, nil
+}
+
+// Capture runs command on the target and returns what it prints, without
+// showing it. The error includes what the command printed to stderr.
+func (c *Client) Capture(target Target, command string) ([]byte, error) {
+	client, err := c.client(target)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	if c.Verbose {
+		c.Output.Printf("Executing remote command: %s\n", command)
+	}
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+
+	if err := session.Run(command); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w", msg, err)
+		}
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,376 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/huh"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyStatus describes how a host key compares to known_hosts and the
+// fingerprints pinned in the configuration.
+type HostKeyStatus int
+
+const (
+	HostKeyTrusted HostKeyStatus = iota
+	HostKeyUnknown
+	HostKeyMismatch
+	HostKeyPinMismatch
+)
+
+func (s HostKeyStatus) String() string {
+	switch s {
+	case HostKeyTrusted:
+		return "trusted"
+	case HostKeyUnknown:
+		return "unknown"
+	case HostKeyMismatch:
+		return "mismatch"
+	case HostKeyPinMismatch:
+		return "pin mismatch"
+	default:
+		return "invalid"
+	}
+}
+
+// errHandshakeDone aborts a connection once the host key has been seen.
+var errHandshakeDone = errors.New("host key received")
+
+// KnownHostsPath returns the location of the user's known_hosts file.
+func KnownHostsPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, ".ssh", "known_hosts"), nil
+}
+
+// Fingerprint returns the SHA256 fingerprint of key in OpenSSH format.
+func Fingerprint(key ssh.PublicKey) string {
+	return ssh.FingerprintSHA256(key)
+}
+
+// ScanHostKey connects to the target and returns the host key it presents,
+// without attempting to authenticate.
+func (c *Client) ScanHostKey(target Target) (ssh.PublicKey, error) {
+	var hostKey ssh.PublicKey
+	err := c.handshake(target, func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKey = key
+		return errHandshakeDone
+	})
+	if hostKey == nil {
+		return nil, fmt.Errorf("failed to read host key from %s: %w", target.Host, err)
+	}
+
+	return hostKey, nil
+}
+
+// CheckHostKey reports whether key is the expected host key for the target,
+// consulting both the pinned fingerprints and known_hosts.
+func CheckHostKey(target Target, key ssh.PublicKey) (HostKeyStatus, error) {
+	if err := checkPinnedFingerprint(target, key); err != nil {
+		return HostKeyPinMismatch, nil
+	}
+
+	knownHostsPath, err := KnownHostsPath()
+	if err != nil {
+		return HostKeyUnknown, err
+	}
+
+	if _, err := os.Stat(knownHostsPath); os.IsNotExist(err) {
+		return HostKeyUnknown, nil
+	}
+
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return HostKeyUnknown, fmt.Errorf("failed to read %s: %w", knownHostsPath, err)
+	}
+
+	err = callback(address(target.Host), &net.TCPAddr{}, key)
+	var keyErr *knownhosts.KeyError
+	switch {
+	case err == nil:
+		return HostKeyTrusted, nil
+	case errors.As(err, &keyErr) && len(keyErr.Want) == 0:
+		return HostKeyUnknown, nil
+	case errors.As(err, &keyErr):
+		return HostKeyMismatch, nil
+	default:
+		return HostKeyUnknown, err
+	}
+}
+
+// EnsureHostKey verifies the target's host key, prompting to trust it on
+// first use. Deploys call it before rsync so the system ssh finds the key.
+func (c *Client) EnsureHostKey(target Target) error {
+	if c.DryRun {
+		return nil
+	}
+
+	hostKeyCallback, err := c.getHostKeyCallback(target)
+	if err != nil {
+		return fmt.Errorf("failed to get host key callback: %w", err)
+	}
+
+	err = c.handshake(target, func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := hostKeyCallback(hostname, remote, key); err != nil {
+			return err
+		}
+		return errHandshakeDone
+	})
+	if errors.Is(err, errHandshakeDone) {
+		return nil
+	}
+
+	return err
+}
+
+// TrustHostKey appends key to known_hosts as the host key for host.
+func TrustHostKey(host string, key ssh.PublicKey) error {
+	knownHostsPath, err := KnownHostsPath()
+	if err != nil {
+		return err
+	}
+
+	return appendKnownHost(knownHostsPath, address(host), key)
+}
+
+// ForgetHostKey removes every known_hosts entry matching host, including
+// hashed entries, and returns the number of entries removed.
+func ForgetHostKey(host string) (int, error) {
+	knownHostsPath, err := KnownHostsPath()
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(knownHostsPath)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	hostname := knownhosts.Normalize(address(host))
+
+	var kept bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if knownHostsLineMatches(line, hostname) {
+			removed++
+			continue
+		}
+		kept.WriteString(line)
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read %s: %w", knownHostsPath, err)
+	}
+
+	if removed == 0 {
+		return 0, nil
+	}
+
+	if err := os.WriteFile(knownHostsPath, kept.Bytes(), 0600); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", knownHostsPath, err)
+	}
+
+	return removed, nil
+}
+
+func (c *Client) handshake(target Target, callback ssh.HostKeyCallback) error {
+	config := &ssh.ClientConfig{
+		User:            target.User,
+		HostKeyCallback: callback,
+		Timeout:         30 * time.Second,
+	}
+
+	client, err := ssh.Dial("tcp", address(target.Host), config)
+	if err != nil {
+		return err
+	}
+	client.Close()
+
+	return nil
+}
+
+func (c *Client) getHostKeyCallback(target Target) (ssh.HostKeyCallback, error) {
+	knownHostsPath, err := KnownHostsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureKnownHostsFile(knownHostsPath); err != nil {
+		return nil, err
+	}
+
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if err := checkPinnedFingerprint(target, key); err != nil {
+			return err
+		}
+
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return err
+		}
+
+		if len(keyErr.Want) > 0 {
+			return fmt.Errorf("host key for %s has changed (%s %s); if this is expected, run 'deeployer hosts forget' and trust the new key: %w",
+				hostname, key.Type(), Fingerprint(key), err)
+		}
+
+		// Keys matching a pinned fingerprint are trusted without asking.
+		if len(target.HostKeyFingerprints) == 0 {
+			trusted, err := c.confirmHostKey(hostname, key)
+			if err != nil {
+				return err
+			}
+			if !trusted {
+				return fmt.Errorf("host key for %s was not trusted", hostname)
+			}
+		}
+
+		return appendKnownHost(knownHostsPath, hostname, key)
+	}, nil
+}
+
+func (c *Client) confirmHostKey(hostname string, key ssh.PublicKey) (bool, error) {
+	var trusted bool
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title(fmt.Sprintf("The authenticity of host '%s' can't be established.", hostname)).
+				Description(fmt.Sprintf("%s key fingerprint is %s\nTrust this host and add it to known_hosts?", key.Type(), Fingerprint(key))).
+				Affirmative("Trust").
+				Negative("Abort").
+				Value(&trusted),
+		),
+	)
+
+	if err := c.runForm(form); err != nil {
+		return false, fmt.Errorf("failed to confirm host key: %w", err)
+	}
+
+	return trusted, nil
+}
+
+func checkPinnedFingerprint(target Target, key ssh.PublicKey) error {
+	if len(target.HostKeyFingerprints) == 0 {
+		return nil
+	}
+
+	fingerprint := Fingerprint(key)
+	if slices.Contains(target.HostKeyFingerprints, fingerprint) {
+		return nil
+	}
+
+	return fmt.Errorf("host key for %s (%s %s) does not match any pinned fingerprint",
+		target.Host, key.Type(), fingerprint)
+}
+
+func ensureKnownHostsFile(path string) error {
+	if _, err := os.Stat(path); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	return file.Close()
+}
+
+func appendKnownHost(path, hostname string, key ssh.PublicKey) error {
+	if err := ensureKnownHostsFile(path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(file, line); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func knownHostsLineMatches(line, hostname string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+		return false
+	}
+
+	// Leave @cert-authority and @revoked entries alone
+	if strings.HasPrefix(fields[0], "@") {
+		return false
+	}
+
+	for _, pattern := range strings.Split(fields[0], ",") {
+		if pattern == hostname || hashedHostMatches(pattern, hostname) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hashedHostMatches(pattern, hostname string) bool {
+	// Hashed entries have the form |1|base64(salt)|base64(hmac-sha1(salt, host))
+	parts := strings.Split(pattern, "|")
+	if len(parts) != 4 || parts[0] != "" || parts[1] != "1" {
+		return false
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+
+	hash, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(hostname))
+	return hmac.Equal(mac.Sum(nil), hash)
+}
+
+func address(host string) string {
+	if strings.Contains(host, ":") {
+		return host
+	}
+	return host + ":22"
+}
@@ -0,0 +1,150 @@
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func testHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestHashedHostMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		hostname string
+		want     bool
+	}{
+		{"hashed host", knownhosts.HashHostname("example.com"), "example.com", true},
+		{"other host", knownhosts.HashHostname("example.com"), "example.org", false},
+		{"hashed host and port", knownhosts.HashHostname("[example.com]:2222"), "[example.com]:2222", true},
+		{"host without the port", knownhosts.HashHostname("[example.com]:2222"), "example.com", false},
+		{"other port", knownhosts.HashHostname("[example.com]:2222"), "[example.com]:2200", false},
+		{"plain entry", "example.com", "example.com", false},
+		{"unknown hash version", strings.Replace(knownhosts.HashHostname("example.com"), "|1|", "|2|", 1), "example.com", false},
+		{"invalid salt", "|1|not base64!|AAAA", "example.com", false},
+		{"invalid hash", "|1|AAAA|not base64!", "example.com", false},
+		{"missing fields", "|1|AAAA", "example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hashedHostMatches(tt.pattern, tt.hostname); got != tt.want {
+				t.Errorf("hashedHostMatches(%q, %q) = %v, want %v", tt.pattern, tt.hostname, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForgetHostKey(t *testing.T) {
+	key := testHostKey(t)
+	line := func(host string) string {
+		return knownhosts.Line([]string{host}, key)
+	}
+
+	plain := line("example.com")
+	hashed := line(knownhosts.HashHostname("example.com"))
+	plainPort := line("[example.com]:2222")
+	hashedPort := line(knownhosts.HashHostname("[example.com]:2222"))
+	several := line("example.org,example.com")
+	other := line("example.org")
+	authority := "@cert-authority *.example.com " + strings.TrimPrefix(line("x"), "x ")
+	comment := "# example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+
+	knownHosts := []string{plain, hashed, plainPort, hashedPort, several, other, authority, comment}
+
+	tests := []struct {
+		name        string
+		host        string
+		wantRemoved int
+		wantKept    []string
+	}{
+		{
+			name:        "host",
+			host:        "example.com",
+			wantRemoved: 3,
+			wantKept:    []string{plainPort, hashedPort, other, authority, comment},
+		},
+		{
+			name:        "default port",
+			host:        "example.com:22",
+			wantRemoved: 3,
+			wantKept:    []string{plainPort, hashedPort, other, authority, comment},
+		},
+		{
+			name:        "host and port",
+			host:        "example.com:2222",
+			wantRemoved: 2,
+			wantKept:    []string{plain, hashed, several, other, authority, comment},
+		},
+		{
+			name:        "unknown host",
+			host:        "example.net",
+			wantRemoved: 0,
+			wantKept:    knownHosts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+
+			path := filepath.Join(home, ".ssh", "known_hosts")
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(strings.Join(knownHosts, "\n")+"\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			removed, err := ForgetHostKey(tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("removed %d entries, want %d", removed, tt.wantRemoved)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+			if !slices.Equal(kept, tt.wantKept) {
+				t.Errorf("kept\n%s\nwant\n%s", strings.Join(kept, "\n"), strings.Join(tt.wantKept, "\n"))
+			}
+		})
+	}
+}
+
+func TestForgetHostKeyWithoutKnownHosts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	removed, err := ForgetHostKey("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 0 {
+		t.Errorf("removed %d entries from a missing file", removed)
+	}
+}
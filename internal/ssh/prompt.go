@@ -0,0 +1,90 @@
+package ssh
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/huh"
+	"golang.org/x/crypto/ssh"
+)
+
+// promptSecret asks for a secret without echoing it. When CacheSecrets is
+// set, the answer is remembered under key for the rest of the run.
+func (c *Client) promptSecret(key, title string) (string, error) {
+	if secret, ok := c.secrets[key]; ok {
+		return secret, nil
+	}
+
+	var secret string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				Title(title).
+				EchoMode(huh.EchoModePassword).
+				Value(&secret),
+		),
+	)
+
+	if err := c.runForm(form); err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+
+	if c.CacheSecrets {
+		c.secrets[key] = secret
+	}
+
+	return secret, nil
+}
+
+// runForm shows a prompt, through Interact when it is set.
+func (c *Client) runForm(form *huh.Form) error {
+	if c.Interact != nil {
+		return c.Interact(form.Run)
+	}
+	return form.Run()
+}
+
+func (c *Client) forgetSecret(key string) {
+	delete(c.secrets, key)
+}
+
+// keyboardInteractive answers server challenges, such as one-time
+// passwords, by asking the user. Answers are never cached.
+func (c *Client) keyboardInteractive(target Target) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		if len(questions) == 0 {
+			if instruction != "" {
+				c.Output.Printf("%s\n", instruction)
+			}
+			return nil, nil
+		}
+
+		answers := make([]string, len(questions))
+		fields := make([]huh.Field, len(questions))
+		for i, question := range questions {
+			input := huh.NewInput().
+				Title(question).
+				Value(&answers[i])
+			if !echos[i] {
+				input = input.EchoMode(huh.EchoModePassword)
+			}
+			if i == 0 {
+				title := fmt.Sprintf("%s@%s", target.User, target.Host)
+				if name != "" {
+					title += ": " + name
+				}
+				description := title
+				if instruction != "" {
+					description += "\n" + instruction
+				}
+				input = input.Description(description)
+			}
+			fields[i] = input
+		}
+
+		if err := c.runForm(huh.NewForm(huh.NewGroup(fields...))); err != nil {
+			return nil, fmt.Errorf("failed to answer keyboard-interactive challenge: %w", err)
+		}
+
+		return answers, nil
+	}
+}
@@ -0,0 +1,189 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// newSudoPrompt returns a prompt for sudo that no other program prints, so
+// that the password is never sent to anything but sudo.
+func newSudoPrompt() (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate sudo prompt: %w", err)
+	}
+	return "[deeployer sudo " + hex.EncodeToString(nonce) + "] password: ", nil
+}
+
+// withSudoPrompt makes sudo, run by command directly or by any program it
+// starts, ask for a password with prompt.
+func withSudoPrompt(prompt, command string) string {
+	quoted := Quote(prompt)
+	return "sudo() { command sudo -p " + quoted + ` "$@"; }; export SUDO_PROMPT=` + quoted + "; " + command
+}
+
+// executeWithPTY runs command on a remote terminal sized like the local one,
+// answering sudo password prompts as they appear in the output.
+func (c *Client) executeWithPTY(session *ssh.Session, target Target, command string, stdout io.Writer) error {
+	width, height := 80, 24
+	if w, h, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+		width, height = w, h
+	}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          0,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm", height, width, modes); err != nil {
+		return fmt.Errorf("failed to request pty: %w", err)
+	}
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	prompt, err := newSudoPrompt()
+	if err != nil {
+		return err
+	}
+
+	responder := &sudoResponder{
+		dst:    &crlfWriter{dst: stdout},
+		stdin:  stdin,
+		prompt: []byte(prompt),
+		password: func(attempt int) (string, error) {
+			return c.sudoPassword(target, attempt)
+		},
+	}
+
+	// A terminal merges stderr into stdout, so prompts always arrive here
+	session.Stdout = responder
+	session.Stderr = stdout
+
+	err = session.Run(withSudoPrompt(prompt, command))
+	flushErr := responder.dst.Flush()
+	if responder.err != nil {
+		return responder.err
+	}
+	if err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// sudoPassword returns the password used to answer sudo prompts, taken from
+// the remote's configured environment variable or asked for interactively.
+func (c *Client) sudoPassword(target Target, attempt int) (string, error) {
+	key := "sudo " + target.User + "@" + target.Host
+
+	if target.SudoPasswordEnv != "" {
+		if attempt > 0 {
+			return "", fmt.Errorf("sudo rejected the password from $%s", target.SudoPasswordEnv)
+		}
+		password, ok := os.LookupEnv(target.SudoPasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("sudo asked for a password but $%s is not set", target.SudoPasswordEnv)
+		}
+		return password, nil
+	}
+
+	if attempt > 0 {
+		c.forgetSecret(key)
+	}
+
+	return c.promptSecret(key, fmt.Sprintf("[sudo] password for %s@%s", target.User, target.Host))
+}
+
+// sudoResponder relays remote output and writes the sudo password to stdin
+// whenever the pending line ends with sudo's prompt.
+type sudoResponder struct {
+	dst      *crlfWriter
+	stdin    io.WriteCloser
+	prompt   []byte
+	password func(attempt int) (string, error)
+
+	line     []byte
+	attempts int
+	err      error
+}
+
+func (r *sudoResponder) Write(p []byte) (int, error) {
+	if _, err := r.dst.Write(p); err != nil {
+		return 0, err
+	}
+
+	r.line = append(r.line, p...)
+	if i := bytes.LastIndexAny(r.line, "\r\n"); i >= 0 {
+		r.line = r.line[i+1:]
+	}
+
+	if r.err == nil && bytes.HasSuffix(r.line, r.prompt) {
+		r.line = r.line[:0]
+		r.answer()
+	}
+
+	return len(p), nil
+}
+
+func (r *sudoResponder) answer() {
+	password, err := r.password(r.attempts)
+	r.attempts++
+	if err != nil {
+		// Closing stdin makes sudo give up, so the command fails instead of
+		// waiting forever for an answer.
+		r.err = err
+		r.stdin.Close()
+		return
+	}
+
+	if _, err := io.WriteString(r.stdin, password+"\n"); err != nil {
+		r.err = err
+	}
+}
+
+// crlfWriter turns the CRLF line endings produced by a remote terminal into
+// plain LF, holding back a trailing CR until the next write decides it.
+type crlfWriter struct {
+	dst       io.Writer
+	pendingCR bool
+}
+
+func (w *crlfWriter) Write(p []byte) (int, error) {
+	var out []byte
+	if w.pendingCR {
+		if len(p) == 0 || p[0] != '\n' {
+			out = append(out, '\r')
+		}
+		w.pendingCR = false
+	}
+
+	out = append(out, bytes.ReplaceAll(p, []byte("\r\n"), []byte("\n"))...)
+	if len(out) > 0 && out[len(out)-1] == '\r' {
+		out = out[:len(out)-1]
+		w.pendingCR = true
+	}
+
+	if _, err := w.dst.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes out a CR held back by the last write.
+func (w *crlfWriter) Flush() error {
+	if !w.pendingCR {
+		return nil
+	}
+	w.pendingCR = false
+	_, err := w.dst.Write([]byte{'\r'})
+	return err
+}
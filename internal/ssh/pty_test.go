@@ -0,0 +1,196 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCRLFWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"line endings", []string{"a\r\nb\r\n"}, "a\nb\n"},
+		{"split line ending", []string{"a\r", "\nb\r", "\n"}, "a\nb\n"},
+		{"carriage return alone", []string{"10%\r", "20%\r", "\n"}, "10%\r20%\n"},
+		{"carriage return before a line ending", []string{"a\r", "\r\n"}, "a\r\n"},
+		{"trailing carriage return is flushed", []string{"a\r"}, "a\r"},
+		{"plain newlines", []string{"a\n", "b\n"}, "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := &crlfWriter{dst: &out}
+			for _, chunk := range tt.chunks {
+				n, err := w.Write([]byte(chunk))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != len(chunk) {
+					t.Errorf("wrote %d bytes of %d", n, len(chunk))
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeStdin records what is written to a remote command's input.
+type fakeStdin struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (s *fakeStdin) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestSudoResponder(t *testing.T) {
+	const prompt = "[deeployer sudo 0123456789abcdef] password: "
+
+	tests := []struct {
+		name   string
+		chunks []string
+		// passwords are returned for each attempt, where "" fails it
+		passwords  []string
+		wantStdin  string
+		wantClosed bool
+		wantErr    bool
+		wantOutput string
+	}{
+		{
+			name:       "prompt",
+			chunks:     []string{prompt},
+			passwords:  []string{"secret"},
+			wantStdin:  "secret\n",
+			wantOutput: prompt,
+		},
+		{
+			name:       "prompt split across writes",
+			chunks:     []string{"[deeployer sudo 0123", "456789abcdef] pass", "word: "},
+			passwords:  []string{"secret"},
+			wantStdin:  "secret\n",
+			wantOutput: prompt,
+		},
+		{
+			name:       "prompt after earlier lines",
+			chunks:     []string{"Restarting\r\n", prompt},
+			passwords:  []string{"secret"},
+			wantStdin:  "secret\n",
+			wantOutput: "Restarting\n" + prompt,
+		},
+		{
+			name:       "prompt again after a rejected password",
+			chunks:     []string{prompt, "\r\nSorry, try again.\r\n", prompt},
+			passwords:  []string{"wrong", "secret"},
+			wantStdin:  "wrong\nsecret\n",
+			wantOutput: prompt + "\nSorry, try again.\n" + prompt,
+		},
+		{
+			name:       "lookalike prompt",
+			chunks:     []string{"Enter password: "},
+			wantOutput: "Enter password: ",
+		},
+		{
+			name:       "sudo's default prompt",
+			chunks:     []string{"[sudo] password for deploy: "},
+			wantOutput: "[sudo] password for deploy: ",
+		},
+		{
+			name:       "prompt followed by more output",
+			chunks:     []string{prompt + "x"},
+			wantOutput: prompt + "x",
+		},
+		{
+			name:       "prompt printed on its own line",
+			chunks:     []string{prompt + "\r\n"},
+			wantOutput: prompt + "\n",
+		},
+		{
+			name:       "no password",
+			chunks:     []string{prompt, prompt},
+			passwords:  []string{""},
+			wantClosed: true,
+			wantErr:    true,
+			wantOutput: prompt + prompt,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			stdin := &fakeStdin{}
+			r := &sudoResponder{
+				dst:    &crlfWriter{dst: &out},
+				stdin:  stdin,
+				prompt: []byte(prompt),
+				password: func(attempt int) (string, error) {
+					if attempt >= len(tt.passwords) || tt.passwords[attempt] == "" {
+						return "", errors.New("no password")
+					}
+					return tt.passwords[attempt], nil
+				},
+			}
+
+			for _, chunk := range tt.chunks {
+				if _, err := r.Write([]byte(chunk)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r.dst.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := stdin.String(); got != tt.wantStdin {
+				t.Errorf("stdin got %q, want %q", got, tt.wantStdin)
+			}
+			if stdin.closed != tt.wantClosed {
+				t.Errorf("stdin closed = %v, want %v", stdin.closed, tt.wantClosed)
+			}
+			if (r.err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want an error: %v", r.err, tt.wantErr)
+			}
+			if got := out.String(); got != tt.wantOutput {
+				t.Errorf("output got %q, want %q", got, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestWithSudoPrompt(t *testing.T) {
+	got := withSudoPrompt("[deeployer sudo 0123] password: ", "sudo systemctl restart nginx")
+	for _, want := range []string{
+		`command sudo -p '[deeployer sudo 0123] password: ' "$@"`,
+		`export SUDO_PROMPT='[deeployer sudo 0123] password: '`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q does not contain %q", got, want)
+		}
+	}
+	if !strings.HasSuffix(got, "; sudo systemctl restart nginx") {
+		t.Errorf("%q does not end with the command", got)
+	}
+
+	a, err := newSudoPrompt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := newSudoPrompt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b || !strings.HasPrefix(a, "[deeployer sudo ") {
+		t.Errorf("prompts %q and %q are not unique deeployer prompts", a, b)
+	}
+}
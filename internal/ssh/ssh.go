@@ -1,89 +1,191 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"deeployer/internal/events"
+	"deeployer/internal/output"
+
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
-	"golang.org/x/crypto/ssh/knownhosts"
 )
 
+// Authentication methods that can be selected per remote.
+const (
+	AuthAgent               = "agent"
+	AuthPublicKey           = "publickey"
+	AuthPassword            = "password"
+	AuthKeyboardInteractive = "keyboard-interactive"
+)
+
+// DefaultAuthMethods are tried when a remote does not select any.
+var DefaultAuthMethods = []string{AuthAgent, AuthPublicKey}
+
 type Client struct {
 	DryRun  bool
 	Verbose bool
+
+	// CacheSecrets keeps passphrases and passwords in memory for the
+	// lifetime of the client, so each is asked for at most once per run.
+	CacheSecrets bool
+
+	Output *output.Sink
+	Events *events.Bus
+
+	// Interact, when set, wraps every prompt, so that a full-screen display
+	// can hand over the terminal while the user answers.
+	Interact func(prompt func() error) error
+
+	secrets map[string]string
+	conns   map[string]*ssh.Client
+}
+
+// Target describes a remote host and how to reach it.
+type Target struct {
+	Host                string
+	User                string
+	HostKeyFingerprints []string
+
+	Auth            []string
+	IdentityFile    string
+	CertificateFile string
+
+	// PTY runs commands on a remote terminal, as needed by sudo with
+	// requiretty or password prompts.
+	PTY             bool
+	SudoPasswordEnv string
 }
 
 func New(dryRun, verbose bool) *Client {
 	return &Client{
 		DryRun:  dryRun,
 		Verbose: verbose,
+		Output:  output.NewSink(os.Stdout, output.DefaultLimit),
+		secrets: make(map[string]string),
+		conns:   make(map[string]*ssh.Client),
 	}
 }
 
-func (c *Client) ExecuteCommands(host, user string, commands []string) error {
+func (c *Client) ExecuteCommands(target Target, commands []string) error {
 	if len(commands) == 0 {
 		return nil
 	}
 
 	if c.DryRun {
 		for _, cmd := range commands {
-			fmt.Printf("Would execute on %s@%s: %s\n", user, host, cmd)
+			c.Output.Printf("Would execute on %s@%s: %s\n", target.User, target.Host, cmd)
 		}
 		return nil
 	}
 
-	client, err := c.connect(host, user)
+	client, err := c.connect(target)
 	if err != nil {
-		return fmt.Errorf("failed to connect to %s@%s: %w", user, host, err)
+		return fmt.Errorf("failed to connect to %s@%s: %w", target.User, target.Host, err)
 	}
 	defer client.Close()
 
 	for _, command := range commands {
-		if err := c.executeCommand(client, command); err != nil {
-			return fmt.Errorf("command failed on %s@%s: %s: %w", user, host, command, err)
+		if err := c.executeCommand(client, target, command, nil); err != nil {
+			return fmt.Errorf("command failed on %s@%s: %s: %w", target.User, target.Host, command, err)
 		}
 	}
 
 	return nil
 }
 
-func (c *Client) connect(host, user string) (*ssh.Client, error) {
-	config, err := c.getSSHConfig(user)
+// Run executes a single command on the target. The connection is kept open
+// for later commands to the same target until Close is called.
+func (c *Client) Run(target Target, command string) error {
+	if c.DryRun {
+		c.Output.Printf("Would execute on %s@%s: %s\n", target.User, target.Host, command)
+		return nil
+	}
+
+	client, err := c.client(target)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	address := host + ":22"
-	if strings.Contains(host, ":") {
-		address = host
+	if err := c.executeCommand(client, target, command, nil); err != nil {
+		return fmt.Errorf("command failed on %s@%s: %s: %w", target.User, target.Host, command, err)
 	}
 
-	client, err := ssh.Dial("tcp", address, config)
+	return nil
+}
+
+// client returns the connection to target kept open by earlier calls, or
+// opens one.
+func (c *Client) client(target Target) (*ssh.Client, error) {
+	key := target.User + "@" + target.Host
+	if client, ok := c.conns[key]; ok {
+		return client, nil
+	}
+
+	client, err := c.connect(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", key, err)
+	}
+	c.conns[key] = client
+	return client, nil
+}
+
+// Close closes the connections opened by Run.
+func (c *Client) Close() error {
+	var errs []error
+	for key, client := range c.conns {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(c.conns, key)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) connect(target Target) (*ssh.Client, error) {
+	config, err := c.getSSHConfig(target)
 	if err != nil {
 		return nil, err
 	}
 
+	client, err := ssh.Dial("tcp", address(target.Host), config)
+	if err != nil {
+		// Never reuse a password that may have been rejected
+		c.forgetSecret(passwordKey(target))
+		return nil, err
+	}
+
 	return client, nil
 }
 
-func (c *Client) getSSHConfig(user string) (*ssh.ClientConfig, error) {
-	hostKeyCallback, err := c.getHostKeyCallback()
+// passwordAttempts is how many times a password is asked for on one
+// connection before giving up.
+const passwordAttempts = 3
+
+// passwordKey is the key a target's login password is cached under.
+func passwordKey(target Target) string {
+	return "password " + target.User + "@" + target.Host
+}
+
+func (c *Client) getSSHConfig(target Target) (*ssh.ClientConfig, error) {
+	hostKeyCallback, err := c.getHostKeyCallback(target)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get host key callback: %w", err)
 	}
 
-	authMethods, err := c.getAuthMethods()
+	authMethods, err := c.getAuthMethods(target)
 	if err != nil {
 		return nil, err
 	}
 
 	config := &ssh.ClientConfig{
-		User:            user,
+		User:            target.User,
 		Auth:            authMethods,
 		HostKeyCallback: hostKeyCallback,
 		Timeout:         30 * time.Second,
@@ -92,30 +194,42 @@ func (c *Client) getSSHConfig(user string) (*ssh.ClientConfig, error) {
 	return config, nil
 }
 
-func (c *Client) getHostKeyCallback() (ssh.HostKeyCallback, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return nil, err
+func (c *Client) getAuthMethods(target Target) ([]ssh.AuthMethod, error) {
+	methods := target.Auth
+	if len(methods) == 0 {
+		methods = DefaultAuthMethods
 	}
 
-	knownHostsPath := filepath.Join(homeDir, ".ssh", "known_hosts")
-	if _, err := os.Stat(knownHostsPath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("known_hosts file not found at %s", knownHostsPath)
-	}
-
-	return knownhosts.New(knownHostsPath)
-}
-
-func (c *Client) getAuthMethods() ([]ssh.AuthMethod, error) {
 	var authMethods []ssh.AuthMethod
-
-	if agentAuth := c.getSSHAgent(); agentAuth != nil {
-		authMethods = append(authMethods, agentAuth)
-	}
-
-	keyAuth, err := c.getPublicKeyAuth()
-	if err == nil {
-		authMethods = append(authMethods, keyAuth)
+	for _, method := range methods {
+		switch method {
+		case AuthAgent:
+			if agentAuth := c.getSSHAgent(); agentAuth != nil {
+				authMethods = append(authMethods, agentAuth)
+			}
+		case AuthPublicKey:
+			keyAuth, err := c.getPublicKeyAuth(target)
+			if err == nil {
+				authMethods = append(authMethods, keyAuth)
+			} else if target.IdentityFile != "" {
+				return nil, err
+			}
+		case AuthPassword:
+			key := passwordKey(target)
+			attempts := 0
+			// A rejected password is asked for again rather than resent
+			authMethods = append(authMethods, ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
+				if attempts > 0 {
+					c.forgetSecret(key)
+				}
+				attempts++
+				return c.promptSecret(key, fmt.Sprintf("Password for %s@%s", target.User, target.Host))
+			}), passwordAttempts))
+		case AuthKeyboardInteractive:
+			authMethods = append(authMethods, ssh.KeyboardInteractive(c.keyboardInteractive(target)))
+		default:
+			return nil, fmt.Errorf("unknown authentication method: %s", method)
+		}
 	}
 
 	if len(authMethods) == 0 {
@@ -138,25 +252,66 @@ func (c *Client) getSSHAgent() ssh.AuthMethod {
 	return nil
 }
 
-func (c *Client) getPublicKeyAuth() (ssh.AuthMethod, error) {
-	homeDir, err := os.UserHomeDir()
+func (c *Client) getPublicKeyAuth(target Target) (ssh.AuthMethod, error) {
+	keyPaths, err := identityFiles(target)
 	if err != nil {
 		return nil, err
 	}
 
-	keyPaths := []string{
-		filepath.Join(homeDir, ".ssh", "id_rsa"),
-		filepath.Join(homeDir, ".ssh", "id_ed25519"),
-		filepath.Join(homeDir, ".ssh", "id_ecdsa"),
+	// Keys are loaded lazily so that passphrases are only asked for when
+	// the methods before this one have failed.
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		var signers []ssh.Signer
+		for _, keyPath := range keyPaths {
+			signer, err := c.loadPrivateKey(keyPath)
+			if err != nil {
+				if c.Verbose {
+					c.Output.Printf("Skipping private key %s: %v\n", keyPath, err)
+				}
+				continue
+			}
+
+			if cert, err := c.loadCertificate(target, keyPath, signer); err == nil {
+				signers = append(signers, cert)
+			} else if !os.IsNotExist(err) && c.Verbose {
+				c.Output.Printf("Skipping certificate for %s: %v\n", keyPath, err)
+			}
+			signers = append(signers, signer)
+		}
+		return signers, nil
+	}), nil
+}
+
+func identityFiles(target Target) ([]string, error) {
+	if target.IdentityFile != "" {
+		keyPath, err := expandHome(target.IdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(keyPath); err != nil {
+			return nil, fmt.Errorf("identity file not readable: %w", err)
+		}
+		return []string{keyPath}, nil
 	}
 
-	for _, keyPath := range keyPaths {
-		if key, err := c.loadPrivateKey(keyPath); err == nil {
-			return ssh.PublicKeys(key), nil
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var keyPaths []string
+	for _, name := range []string{"id_rsa", "id_ed25519", "id_ecdsa"} {
+		keyPath := filepath.Join(homeDir, ".ssh", name)
+		if _, err := os.Stat(keyPath); err == nil {
+			keyPaths = append(keyPaths, keyPath)
 		}
 	}
 
-	return nil, fmt.Errorf("no private keys found")
+	if len(keyPaths) == 0 {
+		return nil, fmt.Errorf("no private keys found")
+	}
+
+	return keyPaths, nil
 }
 
 func (c *Client) loadPrivateKey(path string) (ssh.Signer, error) {
@@ -166,14 +321,76 @@ func (c *Client) loadPrivateKey(path string) (ssh.Signer, error) {
 	}
 
 	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+
+	passphrase, err := c.promptSecret("passphrase "+path, fmt.Sprintf("Passphrase for %s", path))
 	if err != nil {
 		return nil, err
 	}
 
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	if err != nil {
+		c.forgetSecret("passphrase " + path)
+		return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+	}
+
 	return signer, nil
 }
 
-func (c *Client) executeCommand(client *ssh.Client, command string) error {
+// loadCertificate pairs signer with its OpenSSH certificate, read from the
+// configured certificate file or from <key>-cert.pub next to the key.
+func (c *Client) loadCertificate(target Target, keyPath string, signer ssh.Signer) (ssh.Signer, error) {
+	certPath := keyPath + "-cert.pub"
+	if target.CertificateFile != "" {
+		expanded, err := expandHome(target.CertificateFile)
+		if err != nil {
+			return nil, err
+		}
+		certPath = expanded
+	}
+
+	data, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate %s: %w", certPath, err)
+	}
+
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an OpenSSH certificate", certPath)
+	}
+
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %s does not match %s: %w", certPath, keyPath, err)
+	}
+
+	return certSigner, nil
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(homeDir, path[1:]), nil
+}
+
+// executeCommand runs command, reading stdin when it is not nil. Commands
+// with input never get a terminal, which would echo it.
+func (c *Client) executeCommand(client *ssh.Client, target Target, command string, stdin io.Reader) error {
 	session, err := client.NewSession()
 	if err != nil {
 		return err
@@ -181,11 +398,36 @@ func (c *Client) executeCommand(client *ssh.Client, command string) error {
 	defer session.Close()
 
 	if c.Verbose {
-		fmt.Printf("Executing remote command: %s\n", command)
+		c.Output.Printf("Executing remote command: %s\n", command)
+	}
+
+	step := c.Output.Step(target.Host, command)
+	c.Events.Publish(events.CommandStarted{Source: target.Host, Command: command})
+
+	if target.PTY && stdin == nil {
+		err = c.executeWithPTY(session, target, command, step)
+	} else {
+		session.Stdin = stdin
+		session.Stdout = step
+		session.Stderr = step
+		err = session.Run(command)
 	}
 
-	session.Stdout = os.Stdout
-	session.Stderr = os.Stderr
+	step.Finish(err)
+	c.Events.Publish(events.Exited(target.Host, command, step.StartedAt, exitStatus(err), err))
+	return err
+}
+
+// exitStatus returns the remote command's exit status, or -1 when it did
+// not report one, as when the connection is lost.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
 
-	return session.Run(command)
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	return -1
 }
@@ -0,0 +1,466 @@
+// Package tui shows a running deploy as a full-screen dashboard, fed by the
+// events published on an events.Bus.
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"deeployer/internal/events"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// ErrInterrupted is returned by Run when the user quits with ctrl+c before
+// the work is done.
+var ErrInterrupted = errors.New("deploy interrupted")
+
+// tailLines is how much output a running or failed step shows inline.
+const tailLines = 5
+
+// maxLogLines caps the lines kept per step for the full log view.
+const maxLogLines = 10000
+
+// Dashboard is a full-screen view of a deploy.
+type Dashboard struct {
+	// OnInterrupt, when set, is called on the first ctrl+c instead of
+	// quitting, so that the work can stop cleanly. A second ctrl+c quits.
+	OnInterrupt func()
+
+	program *tea.Program
+	model   *model
+}
+
+// New creates a dashboard titled title, showing the given phases as
+// pending until they start.
+func New(title string, phases []string) *Dashboard {
+	m := newModel(title, phases)
+	return &Dashboard{
+		program: tea.NewProgram(m, tea.WithAltScreen()),
+		model:   m,
+	}
+}
+
+// Run shows the dashboard while work runs and returns work's error. On
+// success the dashboard closes by itself; after a failure it stays open so
+// the logs can be inspected.
+func (d *Dashboard) Run(bus *events.Bus, work func() error) error {
+	d.model.onInterrupt = d.OnInterrupt
+	bus.Subscribe(func(e events.Event) {
+		d.program.Send(eventMsg{e})
+	})
+
+	go func() {
+		d.program.Send(doneMsg{err: work()})
+	}()
+
+	final, err := d.program.Run()
+	if err != nil {
+		return fmt.Errorf("dashboard failed: %w", err)
+	}
+
+	m := final.(*model)
+	if !m.done {
+		return ErrInterrupted
+	}
+	return m.err
+}
+
+// Interact hands the terminal to prompt, such as a password form, and takes
+// it back afterwards.
+func (d *Dashboard) Interact(prompt func() error) error {
+	if err := d.program.ReleaseTerminal(); err != nil {
+		return err
+	}
+	defer d.program.RestoreTerminal()
+
+	return prompt()
+}
+
+type eventMsg struct {
+	event events.Event
+}
+
+type doneMsg struct {
+	err error
+}
+
+type phaseState struct {
+	name     string
+	status   string
+	started  time.Time
+	duration time.Duration
+	steps    []*stepState
+	progress *events.SyncProgress
+}
+
+type stepState struct {
+	source   string
+	command  string
+	started  time.Time
+	duration time.Duration
+	finished bool
+	exitCode int
+	lines    []string
+}
+
+type model struct {
+	title   string
+	started time.Time
+	phases  []*phaseState
+	steps   []*stepState
+
+	selected int
+	expanded bool
+	log      viewport.Model
+
+	spinner spinner.Model
+	bar     progress.Model
+	width   int
+	height  int
+
+	onInterrupt  func()
+	interrupting bool
+
+	done     bool
+	finished time.Time
+	err      error
+}
+
+var (
+	titleStyle   = lipgloss.NewStyle().Bold(true)
+	faintStyle   = lipgloss.NewStyle().Faint(true)
+	okStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	failStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	selectStyle  = lipgloss.NewStyle().Reverse(true)
+	panelStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	runningPanel = panelStyle.BorderForeground(lipgloss.Color("4"))
+)
+
+func newModel(title string, phases []string) *model {
+	m := &model{
+		title:   title,
+		started: time.Now(),
+		spinner: spinner.New(spinner.WithSpinner(spinner.Dot)),
+		bar:     progress.New(progress.WithDefaultGradient(), progress.WithWidth(30)),
+		width:   80,
+		height:  24,
+	}
+	for _, name := range phases {
+		m.phases = append(m.phases, &phaseState{name: name})
+	}
+	return m
+}
+
+func (m *model) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.log.Width, m.log.Height = msg.Width, max(msg.Height-2, 1)
+		return m, nil
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case eventMsg:
+		m.handleEvent(msg.event)
+		return m, nil
+
+	case doneMsg:
+		m.done = true
+		m.finished = time.Now()
+		m.err = msg.err
+		if msg.err == nil {
+			return m, tea.Quit
+		}
+		m.selectFailed()
+		return m, nil
+	}
+
+	return m, nil
+}
+
+func (m *model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		if !m.done && m.onInterrupt != nil && !m.interrupting {
+			m.interrupting = true
+			m.onInterrupt()
+			return m, nil
+		}
+		return m, tea.Quit
+	case "q":
+		if m.done {
+			return m, tea.Quit
+		}
+	}
+
+	if m.expanded {
+		switch msg.String() {
+		case "esc", "enter":
+			m.expanded = false
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.log, cmd = m.log.Update(msg)
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "up", "k":
+		if m.selected > 0 {
+			m.selected--
+		}
+	case "down", "j":
+		if m.selected < len(m.steps)-1 {
+			m.selected++
+		}
+	case "enter":
+		if m.selected < len(m.steps) {
+			m.expanded = true
+			m.log = viewport.New(m.width, max(m.height-2, 1))
+			m.log.SetContent(strings.Join(m.steps[m.selected].lines, "\n"))
+			m.log.GotoBottom()
+		}
+	}
+
+	return m, nil
+}
+
+func (m *model) handleEvent(e events.Event) {
+	switch e := e.(type) {
+	case events.PhaseStarted:
+		if phase := m.phase(e.Phase); phase != nil {
+			phase.status = "running"
+			phase.started = time.Now()
+		}
+
+	case events.PhaseFinished:
+		if phase := m.phase(e.Phase); phase != nil {
+			phase.status = e.Status
+			phase.duration = time.Duration(e.DurationMS) * time.Millisecond
+		}
+
+	case events.CommandStarted:
+		step := &stepState{source: e.Source, command: e.Command, started: time.Now()}
+		if phase := m.running(); phase != nil {
+			phase.steps = append(phase.steps, step)
+		}
+		// Follow the newest step unless the user has moved away from it
+		if m.selected >= len(m.steps)-1 {
+			m.selected = len(m.steps)
+		}
+		m.steps = append(m.steps, step)
+
+	case events.OutputLine:
+		if step := m.step(e.Source, e.Command); step != nil {
+			step.lines = append(step.lines, e.Line)
+			if len(step.lines) > maxLogLines {
+				step.lines = step.lines[len(step.lines)-maxLogLines:]
+			}
+			if m.expanded && m.steps[m.selected] == step {
+				m.log.SetContent(strings.Join(step.lines, "\n"))
+			}
+		}
+
+	case events.CommandExited:
+		if step := m.step(e.Source, e.Command); step != nil {
+			step.finished = true
+			step.exitCode = e.ExitCode
+			step.duration = time.Duration(e.DurationMS) * time.Millisecond
+		}
+
+	case events.SyncProgress:
+		if phase := m.running(); phase != nil {
+			progress := e
+			phase.progress = &progress
+		}
+	}
+}
+
+func (m *model) phase(name string) *phaseState {
+	for _, phase := range m.phases {
+		if phase.name == name {
+			return phase
+		}
+	}
+	return nil
+}
+
+func (m *model) running() *phaseState {
+	for _, phase := range m.phases {
+		if phase.status == "running" {
+			return phase
+		}
+	}
+	return nil
+}
+
+// step returns the latest step running command on source.
+func (m *model) step(source, command string) *stepState {
+	for i := len(m.steps) - 1; i >= 0; i-- {
+		if m.steps[i].source == source && m.steps[i].command == command {
+			return m.steps[i]
+		}
+	}
+	return nil
+}
+
+func (m *model) selectFailed() {
+	for i, step := range m.steps {
+		if step.finished && step.exitCode != 0 {
+			m.selected = i
+			return
+		}
+	}
+}
+
+func (m *model) View() string {
+	if m.expanded && m.selected < len(m.steps) {
+		step := m.steps[m.selected]
+		header := titleStyle.Render(fmt.Sprintf("[%s] %s", step.source, step.command))
+		footer := faintStyle.Render("↑/↓ scroll • esc back")
+		return header + "\n" + m.log.View() + "\n" + footer
+	}
+
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(m.title))
+	elapsed := time.Since(m.started)
+	if m.done {
+		elapsed = m.finished.Sub(m.started)
+	}
+	b.WriteString(faintStyle.Render("  " + formatDuration(elapsed)))
+	b.WriteString("\n")
+
+	for _, phase := range m.phases {
+		b.WriteString(m.viewPhase(phase))
+		b.WriteString("\n")
+	}
+
+	switch {
+	case m.done && m.err != nil:
+		b.WriteString(failStyle.Render("Deploy failed: "+m.err.Error()) + "\n")
+		b.WriteString(faintStyle.Render("↑/↓ select • enter full log • q quit"))
+	case m.interrupting:
+		b.WriteString(failStyle.Render("Interrupting: finishing the current step and cleaning up") + "\n")
+		b.WriteString(faintStyle.Render("↑/↓ select • enter full log • ctrl+c quit now"))
+	default:
+		b.WriteString(faintStyle.Render("↑/↓ select • enter full log • ctrl+c interrupt"))
+	}
+
+	// Keep the end in view when the panels outgrow the screen
+	lines := strings.Split(b.String(), "\n")
+	if m.height > 1 && len(lines) > m.height {
+		lines = append(lines[:1], lines[len(lines)-m.height+1:]...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *model) viewPhase(phase *phaseState) string {
+	var b strings.Builder
+
+	header := fmt.Sprintf("%s %s", m.statusIcon(phase.status), phase.name)
+	switch phase.status {
+	case "running":
+		header += faintStyle.Render("  " + formatDuration(time.Since(phase.started)))
+	case "succeeded", "failed":
+		header += faintStyle.Render("  " + formatDuration(phase.duration))
+	case "skipped":
+		header += faintStyle.Render("  skipped")
+	}
+	b.WriteString(titleStyle.Render(header))
+
+	for _, step := range phase.steps {
+		b.WriteString("\n")
+		b.WriteString(m.viewStep(step))
+	}
+
+	if phase.status == "running" && phase.progress != nil {
+		p := phase.progress
+		b.WriteString(fmt.Sprintf("\n%s %3d%% %s",
+			m.bar.ViewAs(float64(p.Percent)/100), p.Percent,
+			faintStyle.Render(fmt.Sprintf("%s  ETA %s", p.Rate, p.ETA))))
+	}
+
+	style := panelStyle
+	if phase.status == "running" {
+		style = runningPanel
+	}
+	return style.Width(max(m.width-2, 20)).Render(b.String())
+}
+
+func (m *model) viewStep(step *stepState) string {
+	var icon, elapsed string
+	switch {
+	case !step.finished:
+		icon = m.spinner.View()
+		elapsed = formatDuration(time.Since(step.started))
+	case step.exitCode == 0:
+		icon = okStyle.Render("✓")
+		elapsed = formatDuration(step.duration)
+	default:
+		icon = failStyle.Render("✗")
+		elapsed = fmt.Sprintf("exit %d, %s", step.exitCode, formatDuration(step.duration))
+	}
+
+	command := step.command
+	if limit := m.width - 30; limit > 10 && len(command) > limit {
+		command = command[:limit-1] + "…"
+	}
+
+	line := fmt.Sprintf("%s [%s] %s", icon, step.source, command)
+	if m.selected < len(m.steps) && m.steps[m.selected] == step {
+		line = selectStyle.Render(line)
+	}
+	line += faintStyle.Render("  " + elapsed)
+
+	// Show what a running or failed step is printing
+	if !step.finished || step.exitCode != 0 {
+		tail := step.lines
+		if len(tail) > tailLines {
+			tail = tail[len(tail)-tailLines:]
+		}
+		for _, l := range tail {
+			line += "\n" + faintStyle.Render("    "+l)
+		}
+	}
+
+	return line
+}
+
+func (m *model) statusIcon(status string) string {
+	switch status {
+	case "running":
+		return m.spinner.View()
+	case "succeeded":
+		return okStyle.Render("✓")
+	case "failed":
+		return failStyle.Render("✗")
+	case "skipped":
+		return faintStyle.Render("-")
+	default:
+		return faintStyle.Render("·")
+	}
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%.1fs", d.Seconds())
+	}
+	return fmt.Sprintf("%dm%02ds", int(d.Minutes()), int(d.Seconds())%60)
+}
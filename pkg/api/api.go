@@ -0,0 +1,232 @@
+// Package api defines the machine-readable output of deeployer, as printed
+// with --output json or --output yaml. Fields are only ever added, never
+// renamed or removed, so scripts can rely on them.
+package api
+
+import "time"
+
+// ListResult is the output of the list command.
+type ListResult struct {
+	Projects []Project `json:"projects" yaml:"projects"`
+	Remotes  []Remote  `json:"remotes" yaml:"remotes"`
+}
+
+// Project is a configured project with defaults applied.
+type Project struct {
+	Name          string              `json:"name" yaml:"name"`
+	Path          string              `json:"path" yaml:"path"`
+	OutputDir     string              `json:"output_dir" yaml:"output_dir"`
+	BuildCommands []string            `json:"build_commands" yaml:"build_commands"`
+	PostCommands  []string            `json:"post_commands" yaml:"post_commands"`
+	BuildImage    string              `json:"build_image,omitempty" yaml:"build_image,omitempty"`
+	BuildRuntime  string              `json:"build_runtime,omitempty" yaml:"build_runtime,omitempty"`
+	Remotes       []string            `json:"remotes" yaml:"remotes"`
+	Exclude       []string            `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	Include       []string            `json:"include,omitempty" yaml:"include,omitempty"`
+	ExcludeFrom   []string            `json:"exclude_from,omitempty" yaml:"exclude_from,omitempty"`
+	Git           *GitPolicy          `json:"git,omitempty" yaml:"git,omitempty"`
+	Hooks         map[string][]string `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	Sync          []SyncMapping       `json:"sync,omitempty" yaml:"sync,omitempty"`
+	Permissions   `yaml:",inline"`
+
+	// Overrides holds the effective settings of the remotes the project
+	// overrides, keyed by remote name.
+	Overrides map[string]RemoteSettings `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+// RemoteSettings are a remote's settings with a project's overrides applied.
+type RemoteSettings struct {
+	Path         string            `json:"path" yaml:"path"`
+	RsyncOptions []string          `json:"rsync_options" yaml:"rsync_options"`
+	PostCommands []string          `json:"post_commands" yaml:"post_commands"`
+	Env          map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// SyncMapping is a file or directory a project syncs to its remotes.
+type SyncMapping struct {
+	Source       string   `json:"source" yaml:"source"`
+	Dest         string   `json:"dest,omitempty" yaml:"dest,omitempty"`
+	RsyncOptions []string `json:"rsync_options,omitempty" yaml:"rsync_options,omitempty"`
+	Exclude      []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	Include      []string `json:"include,omitempty" yaml:"include,omitempty"`
+	Permissions  `yaml:",inline"`
+}
+
+// Permissions are the owner and modes given to synced files.
+type Permissions struct {
+	Owner    string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Group    string `json:"group,omitempty" yaml:"group,omitempty"`
+	DirMode  string `json:"dir_mode,omitempty" yaml:"dir_mode,omitempty"`
+	FileMode string `json:"file_mode,omitempty" yaml:"file_mode,omitempty"`
+}
+
+// GitPolicy is what a project's repository must satisfy before deploying.
+type GitPolicy struct {
+	RequireClean  bool   `json:"require_clean" yaml:"require_clean"`
+	RequireBranch string `json:"require_branch,omitempty" yaml:"require_branch,omitempty"`
+	RequirePushed bool   `json:"require_pushed" yaml:"require_pushed"`
+	RequireSigned bool   `json:"require_signed" yaml:"require_signed"`
+	RequireTag    bool   `json:"require_tag" yaml:"require_tag"`
+}
+
+// Remote is a configured remote with defaults applied.
+type Remote struct {
+	Name                string              `json:"name" yaml:"name"`
+	Host                string              `json:"host" yaml:"host"`
+	User                string              `json:"user" yaml:"user"`
+	Path                string              `json:"path" yaml:"path"`
+	RsyncOptions        []string            `json:"rsync_options" yaml:"rsync_options"`
+	PostCommands        []string            `json:"post_commands" yaml:"post_commands"`
+	HealthChecks        []string            `json:"health_checks,omitempty" yaml:"health_checks,omitempty"`
+	Hooks               map[string][]string `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+	Preserve            []string            `json:"preserve,omitempty" yaml:"preserve,omitempty"`
+	HostKeyFingerprints []string            `json:"host_key_fingerprints,omitempty" yaml:"host_key_fingerprints,omitempty"`
+	Auth                []string            `json:"auth,omitempty" yaml:"auth,omitempty"`
+	IdentityFile        string              `json:"identity_file,omitempty" yaml:"identity_file,omitempty"`
+	PTY                 bool                `json:"pty" yaml:"pty"`
+	Protected           bool                `json:"protected" yaml:"protected"`
+	ConfirmMessage      string              `json:"confirm_message,omitempty" yaml:"confirm_message,omitempty"`
+	DeployWindow        string              `json:"deploy_window,omitempty" yaml:"deploy_window,omitempty"`
+	Env                 map[string]string   `json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// ValidateResult is the output of the validate command.
+type ValidateResult struct {
+	ConfigPath string  `json:"config_path" yaml:"config_path"`
+	Valid      bool    `json:"valid" yaml:"valid"`
+	Errors     []Issue `json:"errors" yaml:"errors"`
+	Warnings   []Issue `json:"warnings" yaml:"warnings"`
+}
+
+// Issue is a problem found in the configuration. Path locates it, such as
+// "projects.webapp" or "remotes.production.rsync_options".
+type Issue struct {
+	Path    string `json:"path" yaml:"path"`
+	Message string `json:"message" yaml:"message"`
+}
+
+// Phase outcomes reported in PhaseResult.Status.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+// DeployResult is the output of the deploy command.
+type DeployResult struct {
+	Project    string        `json:"project" yaml:"project"`
+	Remote     string        `json:"remote" yaml:"remote"`
+	DryRun     bool          `json:"dry_run" yaml:"dry_run"`
+	Commit     string        `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Ref        string        `json:"ref,omitempty" yaml:"ref,omitempty"`
+	Success    bool          `json:"success" yaml:"success"`
+	Error      string        `json:"error,omitempty" yaml:"error,omitempty"`
+	StartedAt  time.Time     `json:"started_at" yaml:"started_at"`
+	FinishedAt time.Time     `json:"finished_at" yaml:"finished_at"`
+	DurationMS int64         `json:"duration_ms" yaml:"duration_ms"`
+	Phases     []PhaseResult `json:"phases" yaml:"phases"`
+	Transfer   *Transfer     `json:"transfer,omitempty" yaml:"transfer,omitempty"`
+	// Plan is only set for dry runs.
+	Plan *Plan `json:"plan,omitempty" yaml:"plan,omitempty"`
+}
+
+// PhaseResult is the outcome of one phase of a deploy.
+type PhaseResult struct {
+	Name       string `json:"name" yaml:"name"`
+	Status     string `json:"status" yaml:"status"`
+	DurationMS int64  `json:"duration_ms" yaml:"duration_ms"`
+	Error      string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Transfer summarizes the files changed on the remote by the sync.
+type Transfer struct {
+	Created          int   `json:"created" yaml:"created"`
+	Updated          int   `json:"updated" yaml:"updated"`
+	Deleted          int   `json:"deleted" yaml:"deleted"`
+	FilesTransferred int   `json:"files_transferred" yaml:"files_transferred"`
+	TotalSize        int64 `json:"total_size" yaml:"total_size"`
+	TransferredSize  int64 `json:"transferred_size" yaml:"transferred_size"`
+	BytesSent        int64 `json:"bytes_sent" yaml:"bytes_sent"`
+	BytesReceived    int64 `json:"bytes_received" yaml:"bytes_received"`
+}
+
+// Plan is the resolved list of steps a deploy runs.
+type Plan struct {
+	Phases []PlanPhase `json:"phases" yaml:"phases"`
+}
+
+type PlanPhase struct {
+	Name string `json:"name" yaml:"name"`
+	// When is "failed" or "always" for phases that run after a failure.
+	When string `json:"when,omitempty" yaml:"when,omitempty"`
+	// After names the phase that must have started for this one to run.
+	After string     `json:"after,omitempty" yaml:"after,omitempty"`
+	Steps []PlanStep `json:"steps" yaml:"steps"`
+}
+
+// PlanStep is a local command, remote command or sync, as given by Kind.
+type PlanStep struct {
+	Kind    string   `json:"kind" yaml:"kind"`
+	Command string   `json:"command,omitempty" yaml:"command,omitempty"`
+	Dir     string   `json:"dir,omitempty" yaml:"dir,omitempty"`
+	Env     []string `json:"env,omitempty" yaml:"env,omitempty"`
+	Image   string   `json:"image,omitempty" yaml:"image,omitempty"`
+	Remote  string   `json:"remote,omitempty" yaml:"remote,omitempty"`
+	Host    string   `json:"host,omitempty" yaml:"host,omitempty"`
+	User    string   `json:"user,omitempty" yaml:"user,omitempty"`
+	Source  string   `json:"source,omitempty" yaml:"source,omitempty"`
+	Dest    string   `json:"dest,omitempty" yaml:"dest,omitempty"`
+	Options []string `json:"options,omitempty" yaml:"options,omitempty"`
+	Filters []string `json:"filters,omitempty" yaml:"filters,omitempty"`
+	PTY     bool     `json:"pty,omitempty" yaml:"pty,omitempty"`
+}
+
+// StatusResult is the output of the status command.
+type StatusResult struct {
+	Projects []ProjectStatus `json:"projects" yaml:"projects"`
+}
+
+// ProjectStatus is the release running on each remote of a project. Drift
+// is set when the remotes do not all run the same tree.
+type ProjectStatus struct {
+	Project string         `json:"project" yaml:"project"`
+	Drift   bool           `json:"drift" yaml:"drift"`
+	Remotes []RemoteStatus `json:"remotes" yaml:"remotes"`
+}
+
+// RemoteStatus is the manifest read from a remote. Manifest is nil when the
+// remote has none or could not be read, in which case Error says why.
+type RemoteStatus struct {
+	Remote   string    `json:"remote" yaml:"remote"`
+	Manifest *Manifest `json:"manifest,omitempty" yaml:"manifest,omitempty"`
+	Drift    bool      `json:"drift" yaml:"drift"`
+	Error    string    `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Manifest describes the release deployed to a remote.
+type Manifest struct {
+	Project      string    `json:"project" yaml:"project"`
+	Remote       string    `json:"remote" yaml:"remote"`
+	Commit       string    `json:"commit,omitempty" yaml:"commit,omitempty"`
+	Ref          string    `json:"ref,omitempty" yaml:"ref,omitempty"`
+	DeployedBy   string    `json:"deployed_by" yaml:"deployed_by"`
+	DeployedFrom string    `json:"deployed_from" yaml:"deployed_from"`
+	DeployedAt   time.Time `json:"deployed_at" yaml:"deployed_at"`
+	TreeHash     string    `json:"tree_hash" yaml:"tree_hash"`
+}
+
+// VerifyResult is the output of the verify command.
+type VerifyResult struct {
+	Project string `json:"project" yaml:"project"`
+	Remote  string `json:"remote" yaml:"remote"`
+	// Against is what the remote was compared with: manifest or local.
+	Against string       `json:"against" yaml:"against"`
+	Drifted bool         `json:"drifted" yaml:"drifted"`
+	Changes []FileChange `json:"changes" yaml:"changes"`
+}
+
+// FileChange is a file that differs on a remote: added, modified or deleted.
+type FileChange struct {
+	Kind string `json:"kind" yaml:"kind"`
+	Path string `json:"path" yaml:"path"`
+}